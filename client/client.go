@@ -0,0 +1,249 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"wikinodes-server/db"
+)
+
+// Client implements db.StoredWikiManager.
+var _ db.StoredWikiManager = &Client{}
+
+// Error codes of the API, see Error.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTooLarge         = "too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal"
+	CodeUnavailable      = "backend_unavailable"
+	CodeTimeout          = "timeout"
+)
+
+// ErrUnsupported is returned by methods which the API has no
+// endpoint for.
+var ErrUnsupported = errors.New("not supported by the API")
+
+// Error is an error response from the server. Errors with code
+// CodeUnavailable match db.ErrUnavailable with errors.Is, and
+// ones with CodeTimeout match context.DeadlineExceeded, so they
+// can be handled like errors from a local store.
+type Error struct {
+	Status    int    // # HTTP status.
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("wikinodes: %s (%d): %s, request id: %s",
+		e.Code, e.Status, e.Message, e.RequestID)
+}
+
+// Unwrap is for errors.Is, see Error.
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case CodeUnavailable:
+		return db.ErrUnavailable
+	case CodeTimeout:
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// Options of a Client. Zero values mean defaults.
+type Options struct {
+	// HTTPClient used for requests, http.DefaultClient
+	// by default.
+	HTTPClient *http.Client
+	// How many times requests are retried when rate limited
+	// (429) or when the server's backend is unavailable (503),
+	// 3 by default. Negative means never. Requests with side
+	// effects (byneigh, which feeds recommendations) are not
+	// retried on 503, as the backend may have run them already.
+	MaxRetries int
+	// How long to wait before the first retry, 500ms by
+	// default. The wait is doubled for each retry, unless
+	// the server sends a Retry-After header.
+	Backoff time.Duration
+	// Max amount of pairs per relsexist request, 100 by
+	// default, which keeps requests below wapi.max_body_bytes.
+	RelsBatchSize int
+	// Max amount of ids & titles per lookup request, which
+	// should match wapi.lookup_max of the server, 100 by default.
+	LookupBatchSize int
+	// Max 'limit' per list request, which should match
+	// wapi.page_limit_max of the server, 100 by default. Pages
+	// are followed for larger limits, except for lists which
+	// the API doesn't page (randomly ordered ones, autocomplete);
+	// those get at most this many items.
+	PageLimit int
+}
+
+// Client is a typed client of the wikinodes API, mirroring
+// db.StoredWikiManager so that a remote server can be used
+// wherever a local store is. Requests are made with the
+// endpoints of /api/v1 (see wapi/routes.go).
+type Client struct {
+	baseURL string
+	hc      *http.Client
+	opts    Options
+}
+
+// New sets up a Client for the server at <baseURL>, such as
+// "http://localhost:1234".
+func New(baseURL string, opts Options) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Millisecond * 500
+	}
+	if opts.RelsBatchSize <= 0 {
+		opts.RelsBatchSize = 100
+	}
+	if opts.LookupBatchSize <= 0 {
+		opts.LookupBatchSize = 100
+	}
+	if opts.PageLimit <= 0 {
+		opts.PageLimit = 100
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		hc:      opts.HTTPClient,
+		opts:    opts,
+	}
+}
+
+// Close closes idle connections, the Client is still usable.
+func (c *Client) Close() error {
+	c.hc.CloseIdleConnections()
+	return nil
+}
+
+// post sends <options> as JSON to the endpoint at <path> (relative
+// to /api/v1) and unmarshals the response into <res>. Rate limited
+// and unavailable responses are retried, see Options.
+func (c *Client) post(ctx context.Context,
+	path string, options interface{}, res interface{}) error {
+	body, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, path, body, res, true)
+}
+
+// postOnce is post for endpoints with side effects, which are only
+// retried when rate limited (those never reach the backend).
+func (c *Client) postOnce(ctx context.Context,
+	path string, options interface{}, res interface{}) error {
+	body, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, path, body, res, false)
+}
+
+// get is like post, but for GET endpoints, which take no options.
+func (c *Client) get(ctx context.Context, path string, res interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, res, true)
+}
+
+// Waits returned by tryDo, besides actual durations.
+const (
+	noRetry      time.Duration = -1
+	retryBackoff time.Duration = -2
+)
+
+// do makes requests with tryDo until one succeeds or shouldn't
+// be retried, see Options. Unavailable responses are only retried
+// if <idempotent>.
+func (c *Client) do(ctx context.Context, method, path string,
+	body []byte, res interface{}, idempotent bool) error {
+	backoff := c.opts.Backoff
+	for retry := 0; ; retry++ {
+		wait, err := c.tryDo(ctx, method, path, body, res, idempotent)
+		if wait == noRetry || retry >= c.opts.MaxRetries {
+			return err
+		}
+		if wait == retryBackoff {
+			wait = backoff
+			backoff *= 2
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tryDo is a single attempt of do. The returned duration is how
+// long to wait before retrying (0 means right away), or one of
+// retryBackoff (the default backoff) and noRetry.
+func (c *Client) tryDo(ctx context.Context, method, path string,
+	body []byte, res interface{}, idempotent bool) (time.Duration, error) {
+	req, err := http.NewRequest(method,
+		c.baseURL+"/api/v1"+path, bytes.NewReader(body))
+	if err != nil {
+		return noRetry, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return noRetry, ctx.Err()
+		}
+		return noRetry, fmt.Errorf("%w: %v", db.ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return noRetry, fmt.Errorf("%w: %v", db.ErrUnavailable, err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return noRetry, json.Unmarshal(b, res)
+	}
+	// # Error envelope, see wapi/errors.go.
+	envelope := struct {
+		Error *Error `json:"error"`
+	}{}
+	if err := json.Unmarshal(b, &envelope); err != nil || envelope.Error == nil {
+		envelope.Error = &Error{Message: strings.TrimSpace(string(b))}
+	}
+	apiErr := envelope.Error
+	apiErr.Status = resp.StatusCode
+
+	retryable := resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusServiceUnavailable && idempotent
+	if !retryable {
+		return noRetry, apiErr
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, apiErr
+	}
+	return retryBackoff, apiErr
+}
+
+// isNotFound tells if <err> is a not_found error response.
+func isNotFound(err error) bool {
+	apiErr := &Error{}
+	return errors.As(err, &apiErr) && apiErr.Code == CodeNotFound
+}
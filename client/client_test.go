@@ -0,0 +1,319 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+	"wikinodes-server/wapi"
+)
+
+var ctx = context.Background()
+
+// newTestServer serves a wapi.Server backed by <m>, returning a
+// Client for it along with a func for cleaning up.
+func newTestServer(m *memgraph.MemGraphManager) (*Client, func()) {
+	conf := config.Default()
+	s := wapi.New(conf.WAPI, m, memcache.New(conf.Cache))
+	ts := httptest.NewServer(s.Handler())
+	return New(ts.URL, Options{}), ts.Close
+}
+
+// titles returns the titles of <data>.
+func titles(data []*db.WikiData) []string {
+	res := make([]string, len(data))
+	for i, d := range data {
+		res[i] = d.Title
+	}
+	return res
+}
+
+func TestClientMirrorsStore(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "the quick fox", "<p>a</p>")
+	b := m.AddArticle("b", "the lazy dog", "")
+	for i := 0; i < 5; i++ {
+		m.AddArticle("c", "", "")
+	}
+	m.AddRel(a, b)
+	c, cleanup := newTestServer(m)
+	defer cleanup()
+
+	res, err := c.SearchArticlesByID(ctx, a)
+	if err != nil || len(res) != 1 || res[0].ID != a || res[0].Title != "a" {
+		t.Fatalf("unexpected byid: %v, %v", err, res)
+	}
+
+	// # Offsets are walked through with cursors.
+	for _, offset := range []int{0, 2, 4, 5} {
+		want, _ := m.SearchArticlesByTitle(ctx, "c", offset, 2)
+		got, err := c.SearchArticlesByTitle(ctx, "c", offset, 2)
+		if err != nil || !reflect.DeepEqual(titles(got), titles(want)) ||
+			len(got) > 0 && got[0].ID != want[0].ID {
+			t.Fatalf("offset %d: wanted %v, got %v, %v", offset, want, got, err)
+		}
+	}
+
+	hits, err := c.SearchArticlesByContent(ctx, "fox", 0, 5)
+	if err != nil || len(hits) != 1 || hits[0].ID != a || hits[0].Snippet == "" {
+		t.Fatalf("unexpected bycontent: %v, %v", err, hits)
+	}
+
+	html, err := c.SearchArticlesHTMLByID(ctx, a)
+	if err != nil || html != "<p>a</p>" {
+		t.Fatalf("unexpected html: %v, %s", err, html)
+	}
+
+	path, err := c.SearchArticlesPathByIDs(ctx, a, b, 3)
+	if err != nil || !reflect.DeepEqual(titles(path), []string{"a", "b"}) {
+		t.Fatalf("unexpected path: %v, %v", err, path)
+	}
+
+	g, err := c.SearchSubgraphByID(ctx, a, 1, 5)
+	if err != nil || len(g.Nodes) != 2 || len(g.Edges) != 1 {
+		t.Fatalf("unexpected subgraph: %v, %+v", err, g)
+	}
+
+	exist, err := c.CheckRelsExistByIDs(ctx, [][2]int64{{a, b}, {b, a}})
+	if err != nil || !reflect.DeepEqual(exist, []bool{true, false}) {
+		t.Fatalf("unexpected relsexist: %v, %v", err, exist)
+	}
+
+	checks, err := c.CheckRelsByIDs(ctx, [][2]int64{{a, b}, {b, a}})
+	if err != nil || !reflect.DeepEqual(checks, []db.WikiRelCheck{{Exists: true}, {}}) {
+		t.Fatalf("unexpected relsexist: %v, %v", err, checks)
+	}
+	edges, err := c.SearchRelsAmongIDs(ctx, []int64{a, b})
+	if err != nil || !reflect.DeepEqual(edges, [][3]int64{{a, b, 0}}) {
+		t.Fatalf("unexpected edges: %v, %v", err, edges)
+	}
+
+	random, err := c.RandomArticles(ctx, 3)
+	if err != nil || len(random) != 3 {
+		t.Fatalf("unexpected random: %v, %v", err, random)
+	}
+	seed := int64(7)
+	sample, err := c.SampleArticles(ctx, db.SampleOptions{Amount: 3, Seed: &seed})
+	want, _ := m.SampleArticles(ctx, db.SampleOptions{Amount: 3, Seed: &seed})
+	if err != nil || !reflect.DeepEqual(sample, want) {
+		t.Fatalf("unexpected sample: %v, %v", err, sample)
+	}
+	neighs, err := c.SampleArticles(ctx, db.SampleOptions{Amount: 3, NeighOf: &a})
+	if err != nil || !reflect.DeepEqual(titles(neighs), []string{"b"}) {
+		t.Fatalf("unexpected neighbours: %v, %v", err, neighs)
+	}
+
+	// # Batches are merged.
+	c.opts.LookupBatchSize = 2
+	lookup, err := c.LookupArticles(ctx, []int64{a, b, 12345}, []string{"a", "nope"})
+	if err != nil || len(lookup.ByID) != 2 || lookup.ByTitle["a"] == nil ||
+		!reflect.DeepEqual(lookup.MissingIDs, []int64{12345}) ||
+		!reflect.DeepEqual(lookup.MissingTitles, []string{"nope"}) {
+		t.Fatalf("unexpected lookup: %v, %+v", err, lookup)
+	}
+
+	data := []*db.WikiData{{ID: a, Title: "a"}}
+	err = c.FillArticleFields(ctx, data, []string{db.FieldSummary, db.FieldOutDegree})
+	if err != nil || data[0].Summary != "the quick fox" || data[0].OutDegree == nil ||
+		*data[0].OutDegree != 1 || data[0].Title != "a" {
+		t.Fatalf("unexpected fields: %v, %+v", err, data[0])
+	}
+
+	if err := c.IncrementRel(ctx, a, b); err != ErrUnsupported {
+		t.Fatalf("unexpected IncrementRel err: %v", err)
+	}
+}
+
+func TestClientLimits(t *testing.T) {
+	m := memgraph.New()
+	hub := m.AddArticle("hub", "", "")
+	for i := 0; i < 150; i++ {
+		m.AddRel(hub, m.AddArticle("c", "", ""))
+	}
+	c, cleanup := newTestServer(m)
+	defer cleanup()
+
+	// # Above wapi.page_limit_max, so pages are followed.
+	res, err := c.SearchArticlesByTitle(ctx, "c", 10, 150)
+	if err != nil || len(res) != 140 {
+		t.Fatalf("unexpected bytitle: %v, %d", err, len(res))
+	}
+	// # Not pageable, so capped rather than rejected.
+	res, err = c.SearchArticlesNeighsByID(ctx, hub, 500)
+	if err != nil || len(res) != c.opts.PageLimit {
+		t.Fatalf("unexpected byneigh: %v, %d", err, len(res))
+	}
+	res, err = c.SampleArticles(ctx, db.SampleOptions{Amount: 500})
+	if err != nil || len(res) != c.opts.PageLimit {
+		t.Fatalf("unexpected sample: %v, %d", err, len(res))
+	}
+	// # Nothing asked for, nothing returned, as with a local store.
+	for _, amount := range []int{0, -1} {
+		res, err = c.RandomArticles(ctx, amount)
+		if err != nil || len(res) != 0 {
+			t.Fatalf("unexpected random (%d): %v, %v", amount, err, res)
+		}
+	}
+}
+
+func TestClientZeroDepths(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "", "")
+	b := m.AddArticle("b", "", "")
+	m.AddRel(a, a)
+	m.AddRel(a, b)
+	c, cleanup := newTestServer(m)
+	defer cleanup()
+
+	// # 0 is taken literally, as with a local store, not as the server's max.
+	for _, dl := range [][2]int{{0, 5}, {1, 0}, {-1, -1}} {
+		want, _ := m.SearchSubgraphByID(ctx, a, dl[0], dl[1])
+		g, err := c.SearchSubgraphByID(ctx, a, dl[0], dl[1])
+		if err != nil || !reflect.DeepEqual(titles(g.Nodes), titles(want.Nodes)) ||
+			!reflect.DeepEqual(g.Edges, want.Edges) {
+			t.Fatalf("%v: wanted %+v, got %v, %+v", dl, want, err, g)
+		}
+	}
+	for _, ft := range [][2]int64{{a, b}, {a, a}, {12345, 12345}} {
+		want, _ := m.SearchArticlesPathByIDs(ctx, ft[0], ft[1], 0)
+		path, err := c.SearchArticlesPathByIDs(ctx, ft[0], ft[1], 0)
+		if err != nil || !reflect.DeepEqual(titles(path), titles(want)) {
+			t.Fatalf("%v: wanted %v, got %v, %v", ft, titles(want), err, titles(path))
+		}
+	}
+}
+
+func TestClientMissingArticles(t *testing.T) {
+	c, cleanup := newTestServer(memgraph.New())
+	defer cleanup()
+
+	// # Not found errors are empty results, like with a local store.
+	html, err := c.SearchArticlesHTMLByID(ctx, 12345)
+	if err != nil || html != "" {
+		t.Fatalf("unexpected html: %v, %s", err, html)
+	}
+	g, err := c.SearchSubgraphByID(ctx, 12345, 1, 1)
+	if err != nil || len(g.Nodes) != 0 {
+		t.Fatalf("unexpected subgraph: %v, %+v", err, g)
+	}
+	path, err := c.SearchArticlesPathByIDs(ctx, 12345, 12346, 1)
+	if err != nil || len(path) != 0 {
+		t.Fatalf("unexpected path: %v, %v", err, path)
+	}
+	missing := int64(12345)
+	sample, err := c.SampleArticles(ctx, db.SampleOptions{Amount: 1, NeighOf: &missing})
+	if err != nil || len(sample) != 0 {
+		t.Fatalf("unexpected sample: %v, %v", err, sample)
+	}
+
+	// # Other errors are returned.
+	_, err = c.SearchArticlesByID(ctx, -1)
+	apiErr := &Error{}
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeBadRequest ||
+		apiErr.Status != http.StatusBadRequest || apiErr.RequestID == "" {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	calls := int32(0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"code":"rate_limited","message":"slow down","requestId":"x"}}`))
+			return
+		}
+		w.Write([]byte(`[{"id":1,"title":"a"}]`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Options{Backoff: time.Millisecond})
+	res, err := c.RandomArticles(ctx, 1)
+	if err != nil || len(res) != 1 || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("unexpected result: %v, %v, calls: %d", err, res, calls)
+	}
+
+	// # Gives up eventually.
+	atomic.StoreInt32(&calls, -100)
+	c = New(ts.URL, Options{Backoff: time.Millisecond, MaxRetries: 2})
+	_, err = c.RandomArticles(ctx, 1)
+	apiErr := &Error{}
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeRateLimited ||
+		atomic.LoadInt32(&calls) != -97 {
+		t.Fatalf("unexpected result: %v, calls: %d", err, calls)
+	}
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	calls := int32(0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":"backend_unavailable","message":"down","requestId":"x"}}`))
+			return
+		}
+		w.Write([]byte(`[{"id":1,"title":"a"}]`))
+	}))
+	defer ts.Close()
+
+	// # Retry-After: 0 is right away, not the (long) backoff.
+	c := New(ts.URL, Options{Backoff: time.Hour})
+	start := time.Now()
+	res, err := c.RandomArticles(ctx, 1)
+	if err != nil || len(res) != 1 || time.Since(start) > time.Minute {
+		t.Fatalf("unexpected result: %v, %v, after %v", err, res, time.Since(start))
+	}
+
+	// # Byneigh has side effects, so 503 isn't retried.
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.SearchArticlesNeighsByID(ctx, 1, 1)
+	if !errors.Is(err, db.ErrUnavailable) || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("unexpected result: %v, calls: %d", err, calls)
+	}
+}
+
+func TestClientUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":{"code":"backend_unavailable","message":"down","requestId":"x"}}`))
+	}))
+	c := New(ts.URL, Options{MaxRetries: -1})
+	if _, err := c.RandomArticles(ctx, 1); !errors.Is(err, db.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got: %v", err)
+	}
+
+	// # Server gone.
+	ts.Close()
+	if _, err := c.RandomArticles(ctx, 1); !errors.Is(err, db.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got: %v", err)
+	}
+}
+
+func TestClientLegacyIDs(t *testing.T) {
+	m := memgraph.New()
+	legacy := int64(7)
+	m.AddArticles(ctx, []*db.WikiArticle{{LegacyID: &legacy, Title: "a"}})
+	conf := config.Default()
+	conf.WAPI.LegacyIDs = true
+	ts := httptest.NewServer(wapi.New(conf.WAPI, m, memcache.New(conf.Cache)).Handler())
+	defer ts.Close()
+	c := New(ts.URL, Options{})
+
+	res, err := c.SearchArticlesByLegacyID(ctx, legacy)
+	if err != nil || len(res) != 1 || res[0].ID != db.StableID("a") {
+		t.Fatalf("unexpected result: %v, %v", err, res)
+	}
+	res, err = c.SearchArticlesByLegacyID(ctx, 8)
+	if err != nil || len(res) != 0 {
+		t.Fatalf("unexpected result: %v, %v", err, res)
+	}
+}
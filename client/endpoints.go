@@ -0,0 +1,396 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"wikinodes-server/db"
+)
+
+// page is a page of a list response, see wapi/pagination.go.
+type page struct {
+	Items      []json.RawMessage `json:"items"`
+	NextCursor string            `json:"nextCursor"`
+}
+
+// walk gets <limit> items from the list endpoint at <path>, after
+// skipping the first <offset>. The API pages with opaque cursors
+// rather than offsets, so pages of <limit> items (at most
+// Options.PageLimit) are walked through until <offset> is reached
+// and <limit> items are collected; large offsets cost several
+// requests, and can't go past wapi.page_offset_max of the server.
+func (c *Client) walk(ctx context.Context, path string,
+	options map[string]interface{}, offset, limit int) ([]json.RawMessage, error) {
+	res := make([]json.RawMessage, 0)
+	if limit <= 0 {
+		return res, nil
+	}
+	options["limit"] = c.pageLimit(limit)
+	options["cursor"] = ""
+	for {
+		p := page{}
+		if err := c.post(ctx, path, options, &p); err != nil {
+			return nil, err
+		}
+		for _, item := range p.Items {
+			if offset > 0 {
+				offset--
+				continue
+			}
+			res = append(res, item)
+			if len(res) == limit {
+				return res, nil
+			}
+		}
+		if p.NextCursor == "" {
+			return res, nil
+		}
+		options["cursor"] = p.NextCursor
+	}
+}
+
+// pageLimit caps <limit> at Options.PageLimit, for list requests.
+func (c *Client) pageLimit(limit int) int {
+	if limit > c.opts.PageLimit {
+		return c.opts.PageLimit
+	}
+	return limit
+}
+
+// walkWikiData is walk for lists of db.WikiData.
+func (c *Client) walkWikiData(ctx context.Context, path string,
+	options map[string]interface{}, offset, limit int) ([]*db.WikiData, error) {
+	items, err := c.walk(ctx, path, options, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*db.WikiData, len(items))
+	for i, item := range items {
+		res[i] = &db.WikiData{}
+		if err := json.Unmarshal(item, res[i]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// SearchArticlesByID implements db.StoredWikiManager.
+func (c *Client) SearchArticlesByID(
+	ctx context.Context, id int64) ([]*db.WikiData, error) {
+	res := make([]*db.WikiData, 0)
+	err := c.post(ctx, "/search/articles/byid",
+		map[string]interface{}{"id": id}, &res)
+	return res, err
+}
+
+// SearchArticlesByLegacyID implements db.StoredWikiManager. The
+// result is empty if there is no such article, or if the server
+// doesn't resolve legacy ids (see wapi.legacy_ids).
+func (c *Client) SearchArticlesByLegacyID(
+	ctx context.Context, legacyID int64) ([]*db.WikiData, error) {
+	res := &db.WikiData{}
+	err := c.get(ctx, fmt.Sprintf("/legacy/articles/%d", legacyID), res)
+	if isNotFound(err) {
+		return make([]*db.WikiData, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []*db.WikiData{res}, nil
+}
+
+// SearchArticlesByTitle implements db.StoredWikiManager.
+func (c *Client) SearchArticlesByTitle(ctx context.Context,
+	title string, offset, limit int) ([]*db.WikiData, error) {
+	return c.walkWikiData(ctx, "/search/articles/bytitle",
+		map[string]interface{}{"title": title}, offset, limit)
+}
+
+// SearchArticlesByTitleFuzzy implements db.StoredWikiManager. At
+// most Options.PageLimit articles are returned.
+func (c *Client) SearchArticlesByTitleFuzzy(ctx context.Context,
+	str string, limit int) ([]*db.WikiData, error) {
+	res := make([]*db.WikiData, 0)
+	if limit <= 0 {
+		return res, nil
+	}
+	err := c.post(ctx, "/search/articles/autocomplete",
+		map[string]interface{}{"str": str, "limit": c.pageLimit(limit)}, &res)
+	return res, err
+}
+
+// SearchArticlesByContent implements db.StoredWikiManager.
+func (c *Client) SearchArticlesByContent(ctx context.Context,
+	str string, offset, limit int) ([]*db.WikiSearchHit, error) {
+	items, err := c.walk(ctx, "/search/articles/bycontent",
+		map[string]interface{}{"str": str}, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*db.WikiSearchHit, len(items))
+	for i, item := range items {
+		res[i] = &db.WikiSearchHit{}
+		if err := json.Unmarshal(item, res[i]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// SearchArticlesNeighsByID implements db.StoredWikiManager. Note
+// that the server uses these searches for recommendation, see
+// IncrementRel. At most Options.PageLimit articles are returned.
+func (c *Client) SearchArticlesNeighsByID(ctx context.Context,
+	id int64, limit int) ([]*db.WikiData, error) {
+	res := make([]*db.WikiData, 0)
+	if limit <= 0 {
+		return res, nil
+	}
+	// # Not retried on 503, see Options.MaxRetries.
+	err := c.postOnce(ctx, "/search/articles/byneigh",
+		map[string]interface{}{"id": id, "limit": c.pageLimit(limit)}, &res)
+	return res, err
+}
+
+// SearchArticlesBacklinksByID implements db.StoredWikiManager. At
+// most Options.PageLimit articles are returned.
+func (c *Client) SearchArticlesBacklinksByID(ctx context.Context,
+	id int64, limit int) ([]*db.WikiData, error) {
+	res := make([]*db.WikiData, 0)
+	if limit <= 0 {
+		return res, nil
+	}
+	err := c.post(ctx, "/search/articles/bylinkedfrom",
+		map[string]interface{}{"id": id, "limit": c.pageLimit(limit)}, &res)
+	return res, err
+}
+
+// SearchSubgraphByID implements db.StoredWikiManager. Like with a
+// local store, the graph is empty if there is no such article, and
+// it only has the article itself if <depth> or <limit> is 0 (which
+// the server would take as its max & default instead).
+func (c *Client) SearchSubgraphByID(ctx context.Context,
+	id int64, depth, limit int) (*db.WikiGraph, error) {
+	// # The smallest graph the server makes, trimmed to the article.
+	root := depth <= 0 || limit <= 0
+	if root {
+		depth, limit = 1, 1
+	}
+	res := &db.WikiGraph{Nodes: []*db.WikiData{}, Edges: [][3]int64{}}
+	err := c.post(ctx, "/search/subgraph",
+		map[string]interface{}{"id": id, "depth": depth, "limit": limit}, res)
+	if isNotFound(err) {
+		return &db.WikiGraph{Nodes: []*db.WikiData{}, Edges: [][3]int64{}}, nil
+	}
+	if err != nil || !root {
+		return res, err
+	}
+	g := &db.WikiGraph{Nodes: []*db.WikiData{}, Edges: [][3]int64{}}
+	for _, v := range res.Nodes {
+		if v.ID == id {
+			g.Nodes = append(g.Nodes, v)
+		}
+	}
+	for _, e := range res.Edges {
+		if e[0] == id && e[1] == id {
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	return g, nil
+}
+
+// SearchArticlesHTMLByID implements db.StoredWikiManager. Like with
+// a local store, the html is empty if there is no such article.
+func (c *Client) SearchArticlesHTMLByID(
+	ctx context.Context, id int64) (string, error) {
+	res := ""
+	err := c.post(ctx, "/search/html/byid",
+		map[string]interface{}{"id": id}, &res)
+	if isNotFound(err) {
+		return "", nil
+	}
+	return res, err
+}
+
+// SearchArticlesPathByIDs implements db.StoredWikiManager. Like with
+// a local store, the path is empty if either article doesn't exist,
+// and a <maxDepth> of 0 (which the server would take as its max)
+// only finds a path from an article to itself.
+func (c *Client) SearchArticlesPathByIDs(ctx context.Context,
+	fromID, toID int64, maxDepth int) ([]*db.WikiData, error) {
+	res := make([]*db.WikiData, 0)
+	if maxDepth <= 0 {
+		if fromID != toID {
+			return res, nil
+		}
+		maxDepth = 1
+	}
+	err := c.post(ctx, "/search/path",
+		map[string]interface{}{"from": fromID, "to": toID, "maxDepth": maxDepth}, &res)
+	if isNotFound(err) {
+		return make([]*db.WikiData, 0), nil
+	}
+	return res, err
+}
+
+// CheckRelsExistByIDs implements db.StoredWikiManager. <relIDs> are
+// sent in batches, see Options.RelsBatchSize.
+func (c *Client) CheckRelsExistByIDs(
+	ctx context.Context, relIDs [][2]int64) ([]bool, error) {
+	res := make([]bool, 0, len(relIDs))
+	err := c.checkRels(ctx, relIDs, false, func(batch json.RawMessage) error {
+		exist := make([]bool, 0)
+		err := json.Unmarshal(batch, &exist)
+		res = append(res, exist...)
+		return err
+	})
+	return res, err
+}
+
+// CheckRelsByIDs implements db.StoredWikiManager. <relIDs> are
+// sent in batches, see Options.RelsBatchSize.
+func (c *Client) CheckRelsByIDs(
+	ctx context.Context, relIDs [][2]int64) ([]db.WikiRelCheck, error) {
+	res := make([]db.WikiRelCheck, 0, len(relIDs))
+	err := c.checkRels(ctx, relIDs, true, func(batch json.RawMessage) error {
+		checks := make([]db.WikiRelCheck, 0)
+		err := json.Unmarshal(batch, &checks)
+		res = append(res, checks...)
+		return err
+	})
+	return res, err
+}
+
+// checkRels sends <relIDs> to the relsexist endpoint in batches, with
+// the <lookups> option, handing each batch response to <f>.
+func (c *Client) checkRels(ctx context.Context, relIDs [][2]int64,
+	lookups bool, f func(json.RawMessage) error) error {
+	for i := 0; i < len(relIDs); i += c.opts.RelsBatchSize {
+		j := i + c.opts.RelsBatchSize
+		if j > len(relIDs) {
+			j = len(relIDs)
+		}
+		batch := json.RawMessage{}
+		err := c.post(ctx, "/check/relsexist",
+			map[string]interface{}{"rels": relIDs[i:j], "lookups": lookups}, &batch)
+		if err != nil {
+			return err
+		}
+		if err := f(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchRelsAmongIDs implements db.StoredWikiManager. All <ids> are
+// sent at once, so there can be at most wapi.lookup_max of them.
+func (c *Client) SearchRelsAmongIDs(
+	ctx context.Context, ids []int64) ([][3]int64, error) {
+	res := make([][3]int64, 0)
+	if ids == nil {
+		ids = []int64{}
+	}
+	err := c.post(ctx, "/check/relsexist",
+		map[string]interface{}{"ids": ids}, &res)
+	return res, err
+}
+
+// RandomArticles implements db.StoredWikiManager.
+func (c *Client) RandomArticles(
+	ctx context.Context, amount int) ([]*db.WikiData, error) {
+	return c.SampleArticles(ctx, db.SampleOptions{Amount: amount})
+}
+
+// SampleArticles implements db.StoredWikiManager. Like with a
+// local store, the sample is empty if there is no opts.NeighOf
+// article. At most Options.PageLimit articles are returned.
+func (c *Client) SampleArticles(
+	ctx context.Context, opts db.SampleOptions) ([]*db.WikiData, error) {
+	res := make([]*db.WikiData, 0)
+	if opts.Amount <= 0 {
+		return res, nil
+	}
+	err := c.post(ctx, "/random/articles", map[string]interface{}{
+		"limit": c.pageLimit(opts.Amount), "neighOf": opts.NeighOf,
+		"minInDegree": opts.MinInDegree, "seed": opts.Seed}, &res)
+	if isNotFound(err) {
+		return make([]*db.WikiData, 0), nil
+	}
+	return res, err
+}
+
+// LookupArticles implements db.StoredWikiManager. <ids> & <titles>
+// are sent in batches, see Options.LookupBatchSize.
+func (c *Client) LookupArticles(ctx context.Context,
+	ids []int64, titles []string) (*db.WikiLookup, error) {
+	return c.lookup(ctx, ids, titles, nil)
+}
+
+// lookup is LookupArticles with optional <fields> (see db.Fields).
+func (c *Client) lookup(ctx context.Context,
+	ids []int64, titles []string, fields []string) (*db.WikiLookup, error) {
+	res := db.NewWikiLookup(nil, nil, nil)
+	for len(ids) > 0 || len(titles) > 0 {
+		// # Ids first, then titles.
+		n := c.opts.LookupBatchSize
+		batchIDs := ids
+		if len(batchIDs) > n {
+			batchIDs = batchIDs[:n]
+		}
+		ids = ids[len(batchIDs):]
+		batchTitles := titles
+		if len(batchTitles) > n-len(batchIDs) {
+			batchTitles = batchTitles[:n-len(batchIDs)]
+		}
+		titles = titles[len(batchTitles):]
+
+		batch := &db.WikiLookup{}
+		err := c.post(ctx, "/lookup/articles", map[string]interface{}{
+			"ids": batchIDs, "titles": batchTitles, "fields": fields}, batch)
+		if err != nil {
+			return nil, err
+		}
+		for id, d := range batch.ByID {
+			res.ByID[id] = d
+		}
+		for title, d := range batch.ByTitle {
+			res.ByTitle[title] = d
+		}
+		res.MissingIDs = append(res.MissingIDs, batch.MissingIDs...)
+		res.MissingTitles = append(res.MissingTitles, batch.MissingTitles...)
+	}
+	return res, nil
+}
+
+// FillArticleFields implements db.StoredWikiManager, by looking up
+// the ids of <data> with the fields asked for.
+func (c *Client) FillArticleFields(
+	ctx context.Context, data []*db.WikiData, fields []string) error {
+	ids := make([]int64, len(data))
+	for i, d := range data {
+		ids[i] = d.ID
+	}
+	res, err := c.lookup(ctx, ids, nil, fields)
+	if err != nil {
+		return err
+	}
+	for _, d := range data {
+		found, ok := res.ByID[d.ID]
+		if !ok {
+			continue
+		}
+		// # Ids & titles are kept as they are.
+		id, title := d.ID, d.Title
+		*d = *found
+		d.ID, d.Title = id, title
+	}
+	return nil
+}
+
+// IncrementRel implements db.StoredWikiManager, though the API has
+// no endpoint for it, so ErrUnsupported is always returned. The
+// server increments rels by itself, based on byneigh searches.
+func (c *Client) IncrementRel(ctx context.Context, v, w int64) error {
+	return ErrUnsupported
+}
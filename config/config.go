@@ -4,37 +4,186 @@ import (
 	"time"
 )
 
+// Config holds all settings of the server. Settings are loaded in
+// layers, see Load. The yaml tags are the keys used in config files,
+// which are also used for env vars and flags (see Load). Fields
+// tagged as secret are redacted when the config is printed.
+type Config struct {
+	Store  Store  `yaml:"store"`
+	Cache  Cache  `yaml:"cache"`
+	Neo4j  Neo4j  `yaml:"neo4j"`
+	Redis  Redis  `yaml:"redis"`
+	WAPI   WAPI   `yaml:"wapi"`
+	Import Import `yaml:"import"`
+}
+
+// Store block.
+type Store struct {
+	// Backend selects the db.StoredWikiManager used by
+	// the server, either "neo4j" or "memory". The latter is
+	// an empty in-process graph, mainly meant for dev & tests.
+	Backend string `yaml:"backend"`
+	// MemorySeed is an optional path to a JSON Lines dump
+	// (see pkg dump) which is imported into the "memory" store
+	// on startup, for serving small demo graphs.
+	MemorySeed string `yaml:"memory_seed"`
+}
+
+// Cache block.
+type Cache struct {
+	// Backend selects the db.CacheManager used by the
+	// server, either "redis" or "memory". The latter keeps
+	// state in-process, so it only fits single-node setups.
+	Backend string `yaml:"backend"`
+
+	// How long to keep track of the last article an IP
+	// searched for, used for article recommendation.
+	QueryTrackExpiration time.Duration `yaml:"query_track_expiration"`
+	// An IP is allowed to make x amount of requests per
+	// t amount of time, where x = DOSGuardAllowancePerRefresh
+	// and t = DOSGuardRefreshDelta.
+	DOSGuardRefreshDelta        time.Duration `yaml:"dosguard_refresh_delta"`
+	DOSGuardAllowancePerRefresh int           `yaml:"dosguard_allowance_per_refresh"`
+}
+
 // Neo4j block.
-var (
-	Neo4jURI = "neo4j://localhost:7687" // Default.
-	Neo4jUSR = "neo4j"                  // Default.
-	Neo4jPWD = "neo4j"                  // Default.
-)
+type Neo4j struct {
+	URI string `yaml:"uri"`
+	USR string `yaml:"user"`
+	PWD string `yaml:"password" secret:"true"`
+
+	// Max amount of connections the driver keeps, which
+	// caps how many queries can run concurrently. Queries
+	// beyond that wait for a connection, for at most
+	// PoolAcquisitionTimeout.
+	MaxPoolSize            int           `yaml:"max_pool_size"`
+	PoolAcquisitionTimeout time.Duration `yaml:"pool_acquisition_timeout"`
+	// How long queries are retried for on transient errors,
+	// such as deadlocks or cluster leader changes.
+	MaxRetryTime time.Duration `yaml:"max_retry_time"`
+}
 
 // Redis block.
-var (
-	RedisIP   = "localhost" // Default.
-	RedisPort = "6379"      // Default.
-	RedisPWD  = ""          // Default.
-	RedisDB   = 0           // Default
-
-	DOSGuardRefreshDelta        = time.Second * 20
-	DOSGuardAllowancePerRefresh = 100
-	QueryTrackExpiration        = time.Second * 20
-)
+type Redis struct {
+	IP   string `yaml:"ip"`
+	Port string `yaml:"port"`
+	PWD  string `yaml:"password" secret:"true"`
+	DB   int    `yaml:"db"`
+}
 
 // WAPI block.
-var (
+type WAPI struct {
 	// Changing IP & Port must match the ones in the
 	// react app, so any changes require an update of
 	// https://github.com/crunchypi/wikinodes-app/tree/master
 	// After changes, a new build of that app is naturally
 	// required.
-	WAPIIP   = "localhost"
-	WAPIPort = "1234"
+	IP   string `yaml:"ip"`
+	Port string `yaml:"port"`
 
-	PathToReactApp = "./www/build/"
+	PathToReactApp string `yaml:"react_app"`
 
-	ReadTimeout  = time.Duration(time.Second * 5)
-	WriteTimeout = time.Duration(time.Second * 5)
-)
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// How long in-flight requests are given to finish when
+	// the server is shutting down (on SIGINT/SIGTERM).
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Default 'limit' option for list endpoints, used when
+	// the option is left out. Limits above PageLimitMax are
+	// rejected, so clients can't make huge queries.
+	PageLimitDefault int `yaml:"page_limit_default"`
+	PageLimitMax     int `yaml:"page_limit_max"`
+	// Max offset of pages, i.e how far cursors can go. Deep
+	// pages are skipped through by the db, which gets slow.
+	PageOffsetMax int `yaml:"page_offset_max"`
+	// Upper bound (and default) for the 'maxDepth' option
+	// of the path search endpoint. Path searches grow very
+	// quickly with depth, so this should be kept low.
+	PathMaxDepth int `yaml:"path_max_depth"`
+	// Upper bounds (and defaults) for the 'depth' and 'limit'
+	// options of the subgraph endpoint; the latter is per level.
+	SubgraphMaxDepth int `yaml:"subgraph_max_depth"`
+	SubgraphMaxLimit int `yaml:"subgraph_max_limit"`
+
+	// Max amount of pairs per db query in a relsexist check; longer
+	// checks are split into chunks of this size.
+	RelsMax int `yaml:"rels_max"`
+	// Max amount of ids & titles (together) in one lookup.
+	LookupMax int `yaml:"lookup_max"`
+	// Max length (in bytes) of search strings, such as
+	// 'title' or 'str' options.
+	StrMaxLen int `yaml:"str_max_len"`
+	// Max size of request bodies; larger ones are rejected
+	// without being read in full.
+	MaxBodyBytes int `yaml:"max_body_bytes"`
+
+	// How long clients (and proxies) may cache responses of
+	// GET endpoints before revalidating them. Article HTML is
+	// large and rarely changes, so it gets its own setting.
+	CacheMaxAge     time.Duration `yaml:"cache_max_age"`
+	HTMLCacheMaxAge time.Duration `yaml:"html_cache_max_age"`
+
+	// Whether /api/v1/legacy/articles/{id} resolves internal
+	// ids of graphs built before stable ids (see db/ids.go),
+	// so links using them keep working after a migration.
+	LegacyIDs bool `yaml:"legacy_ids"`
+}
+
+// Import block.
+type Import struct {
+	// How many articles/links the import subcommand
+	// writes per batch (i.e per db round-trip).
+	BatchSize int `yaml:"batch_size"`
+}
+
+// Default returns the default config, which is the first layer
+// of Load. Note there is no default Neo4j password, it has to be
+// set explicitly when using the neo4j store.
+func Default() *Config {
+	return &Config{
+		Store: Store{
+			Backend: "neo4j",
+		},
+		Cache: Cache{
+			Backend:                     "redis",
+			QueryTrackExpiration:        time.Second * 20,
+			DOSGuardRefreshDelta:        time.Second * 20,
+			DOSGuardAllowancePerRefresh: 100,
+		},
+		Neo4j: Neo4j{
+			URI:                    "neo4j://localhost:7687",
+			USR:                    "neo4j",
+			MaxPoolSize:            100,
+			PoolAcquisitionTimeout: time.Second * 10,
+			MaxRetryTime:           time.Second * 5,
+		},
+		Redis: Redis{
+			IP:   "localhost",
+			Port: "6379",
+		},
+		WAPI: WAPI{
+			IP:               "localhost",
+			Port:             "1234",
+			PathToReactApp:   "./www/build/",
+			ReadTimeout:      time.Second * 5,
+			WriteTimeout:     time.Second * 5,
+			ShutdownTimeout:  time.Second * 15,
+			PageLimitDefault: 10,
+			PageLimitMax:     100,
+			PageOffsetMax:    10000,
+			PathMaxDepth:     6,
+			SubgraphMaxDepth: 3,
+			SubgraphMaxLimit: 25,
+			RelsMax:          100,
+			LookupMax:        100,
+			StrMaxLen:        256,
+			MaxBodyBytes:     1 << 16,
+			CacheMaxAge:      time.Minute,
+			HTMLCacheMaxAge:  time.Hour * 24,
+		},
+		Import: Import{
+			BatchSize: 1000,
+		},
+	}
+}
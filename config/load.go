@@ -0,0 +1,227 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Env var names. Settings are read from env vars named with
+// envPrefix + section + key, e.g WIKINODES_REDIS_PORT.
+const (
+	envPrefix     = "WIKINODES_"
+	envConfigFile = "WIKINODES_CONFIG"
+)
+
+// Replaces secrets when printing a config.
+const redacted = "<redacted>"
+
+// Options are the command-line options that aren't settings.
+type Options struct {
+	// ConfigFile is the path of the YAML file that was
+	// loaded, if any.
+	ConfigFile string
+	// PrintConfig is set with -print-config, which means
+	// that the config should be printed (see Print) rather
+	// than used.
+	PrintConfig bool
+	// Args are the args after the flags, i.e a subcommand
+	// and its args.
+	Args []string
+}
+
+// setting is a single (leaf) field of a Config.
+type setting struct {
+	key    string // # Of form section.key, e.g "redis.port".
+	secret bool
+	v      reflect.Value
+}
+
+// settings returns all fields of <c> as settable settings.
+func (c *Config) settings() []setting {
+	res := make([]setting, 0)
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		sectionKey := root.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			f := section.Type().Field(j)
+			res = append(res, setting{
+				key:    sectionKey + "." + f.Tag.Get("yaml"),
+				secret: f.Tag.Get("secret") == "true",
+				v:      section.Field(j),
+			})
+		}
+	}
+	return res
+}
+
+// envName returns the env var name of the setting.
+func (s setting) envName() string {
+	return envPrefix + strings.ToUpper(strings.Replace(s.key, ".", "_", -1))
+}
+
+// String returns the setting value as it would be given in
+// an env var or flag.
+func (s setting) String() string {
+	return fmt.Sprint(s.v.Interface())
+}
+
+// set parses <str> into the setting, based on its type.
+func (s setting) set(str string) error {
+	switch s.v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.key, err)
+		}
+		s.v.SetInt(int64(d))
+	case int:
+		i, err := strconv.Atoi(str)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.key, err)
+		}
+		s.v.SetInt(int64(i))
+	case bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.key, err)
+		}
+		s.v.SetBool(b)
+	case string:
+		s.v.SetString(str)
+	default:
+		return fmt.Errorf("%s: unsupported setting type", s.key)
+	}
+	return nil
+}
+
+// Load loads a config in layers, each overriding the previous one:
+// 	1. Defaults, see Default.
+// 	2. A YAML file, given with -config or the WIKINODES_CONFIG env var.
+// 	3. Env vars, named WIKINODES_<SECTION>_<KEY>, e.g WIKINODES_REDIS_PORT.
+// 	4. Flags in <args>, named -<section>.<key>, e.g -redis.port.
+// Flag parsing stops at the first non-flag arg; the remaining args
+// are returned in the options. The resulting config is validated.
+func Load(args []string) (*Config, *Options, error) {
+	c := Default()
+	opts := &Options{}
+	settings := c.settings()
+
+	// # Flags are parsed first since -config is one of them,
+	// # but they're applied last.
+	fs := flag.NewFlagSet("wikinodes-server", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config", os.Getenv(envConfigFile),
+		"path of a YAML config file (env "+envConfigFile+")")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false,
+		"print the resulting config (secrets redacted) and exit")
+	flagVals := make(map[string]*string)
+	for _, s := range settings {
+		flagVals[s.key] = fs.String(s.key, s.String(), "env "+s.envName())
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	opts.Args = fs.Args()
+
+	// # File.
+	if opts.ConfigFile != "" {
+		b, err := ioutil.ReadFile(opts.ConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", opts.ConfigFile, err)
+		}
+	}
+	// # Env.
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.envName()); ok {
+			if err := s.set(v); err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", s.envName(), err)
+			}
+		}
+	}
+	// # Flags, only the ones that were actually given.
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.key == f.Name && err == nil {
+				err = s.set(*flagVals[s.key])
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, opts, c.Validate()
+}
+
+// Validate checks that the config is usable, returning an
+// error describing all problems found.
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, a...))
+		}
+	}
+	isPort := func(s string) bool {
+		p, err := strconv.Atoi(s)
+		return err == nil && p > 0 && p < 65536
+	}
+
+	check(c.Store.Backend == "neo4j" || c.Store.Backend == "memory",
+		"store.backend must be 'neo4j' or 'memory', not '%s'", c.Store.Backend)
+	check(c.Store.Backend != "neo4j" || c.Neo4j.PWD != "",
+		"neo4j.password must be set when store.backend is 'neo4j'")
+	check(c.Cache.Backend == "redis" || c.Cache.Backend == "memory",
+		"cache.backend must be 'redis' or 'memory', not '%s'", c.Cache.Backend)
+	check(c.Cache.Backend != "redis" || isPort(c.Redis.Port),
+		"redis.port must be a port number, not '%s'", c.Redis.Port)
+	check(c.Redis.DB >= 0, "redis.db can't be negative")
+	check(isPort(c.WAPI.Port),
+		"wapi.port must be a port number, not '%s'", c.WAPI.Port)
+	check(c.WAPI.PageLimitDefault <= c.WAPI.PageLimitMax,
+		"wapi.page_limit_default can't exceed wapi.page_limit_max")
+
+	// # All durations & ints are amounts which must be positive.
+	for _, s := range c.settings() {
+		switch v := s.v.Interface().(type) {
+		case time.Duration:
+			check(v > 0, "%s must be positive", s.key)
+		case int:
+			check(v > 0 || s.key == "redis.db", "%s must be positive", s.key)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Print writes the config to <w> as YAML, with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	cp := *c // # All values, so this is a deep copy.
+	for _, s := range cp.settings() {
+		if s.secret && s.String() != "" {
+			s.set(redacted)
+		}
+	}
+	b, err := yaml.Marshal(&cp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes <content> to a temp YAML file, returning
+// its path and a func for cleaning up.
+func writeConfigFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "wikinodes-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, opts, err := Load([]string{"-neo4j.password", "x", "import", "-batch", "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.WAPI.Port != "1234" || c.Cache.DOSGuardAllowancePerRefresh != 100 {
+		t.Fatalf("unexpected defaults: %+v", c)
+	}
+	// # Args after the first non-flag are left alone.
+	if strings.Join(opts.Args, " ") != "import -batch 5" {
+		t.Fatalf("unexpected args: %v", opts.Args)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	path, cleanup := writeConfigFile(t, `
+neo4j:
+  password: file
+redis:
+  port: "1111"
+wapi:
+  port: "2222"
+  read_timeout: 1m
+`)
+	defer cleanup()
+
+	os.Setenv("WIKINODES_WAPI_PORT", "3333")
+	os.Setenv("WIKINODES_WAPI_IP", "0.0.0.0")
+	defer os.Unsetenv("WIKINODES_WAPI_PORT")
+	defer os.Unsetenv("WIKINODES_WAPI_IP")
+
+	c, _, err := Load([]string{"-config", path,
+		"-wapi.ip", "127.0.0.1", "-wapi.legacy_ids", "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// # File over defaults.
+	if c.Redis.Port != "1111" || c.WAPI.ReadTimeout != time.Minute {
+		t.Fatalf("file not applied: %+v", c)
+	}
+	// # Env over file.
+	if c.WAPI.Port != "3333" {
+		t.Fatalf("env not applied: %+v", c)
+	}
+	// # Flags over env.
+	if c.WAPI.IP != "127.0.0.1" || !c.WAPI.LegacyIDs {
+		t.Fatalf("flag not applied: %+v", c)
+	}
+	// # Untouched settings keep defaults.
+	if c.Neo4j.USR != "neo4j" || c.Neo4j.PWD != "file" {
+		t.Fatalf("unexpected neo4j block: %+v", c.Neo4j)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path, cleanup := writeConfigFile(t, "wapi:\n  prot: \"1\"\n")
+	defer cleanup()
+
+	cases := [][]string{
+		// # Unknown key in file.
+		{"-config", path},
+		// # Missing file.
+		{"-config", path + ".nope"},
+		// # Bad value.
+		{"-wapi.read_timeout", "soon"},
+		{"-wapi.legacy_ids", "maybe"},
+		// # Unknown flag.
+		{"-wapi.prot", "1"},
+		// # Invalid config: no neo4j password, bad port.
+		{"-wapi.port", "99999"},
+	}
+	for _, args := range cases {
+		if _, _, err := Load(args); err == nil {
+			t.Errorf("expected err for args: %v", args)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.Store.Backend = "memory"
+	c.Cache.Backend = "memory"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	c.Store.Backend = "sqlite"
+	c.WAPI.PageLimitDefault = 0
+	c.WAPI.PageLimitMax = -1
+	c.Cache.DOSGuardRefreshDelta = -time.Second
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected err")
+	}
+	for _, s := range []string{
+		"store.backend", "wapi.page_limit_default", "wapi.page_limit_max",
+		"cache.dosguard_refresh_delta",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected '%s' in err: %v", s, err)
+		}
+	}
+}
+
+func TestPrintRedacts(t *testing.T) {
+	c := Default()
+	c.Neo4j.PWD = "hunter2"
+	buf := bytes.Buffer{}
+	if err := c.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("secret not redacted:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "password: <redacted>") {
+		t.Fatalf("expected redacted password:\n%s", buf.String())
+	}
+	// # The config itself is left alone.
+	if c.Neo4j.PWD != "hunter2" {
+		t.Fatal("config was modified by Print")
+	}
+}
@@ -0,0 +1,9 @@
+package db
+
+import "errors"
+
+// ErrUnavailable is wrapped by errors from StoredWikiManager and
+// CacheManager implementations when their backend can't be reached
+// (as opposed to e.g a bad query), so callers can tell the cases
+// apart with errors.Is.
+var ErrUnavailable = errors.New("backend unavailable")
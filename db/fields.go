@@ -0,0 +1,73 @@
+package db
+
+import (
+	"strings"
+	"unicode"
+)
+
+// WikiData only has an id & title by default, which keeps list
+// responses small. The rest of its fields are optional and are
+// only set when asked for, see StoredWikiManager.FillArticleFields.
+
+// Optional WikiData fields, named as in JSON.
+const (
+	FieldSummary    = "summary"
+	FieldOutDegree  = "outDegree"
+	FieldInDegree   = "inDegree"
+	FieldLookups    = "lookups"
+	FieldCategories = "categories"
+	FieldUpdated    = "updated"
+)
+
+// Fields lists all optional WikiData fields.
+var Fields = []string{FieldSummary, FieldOutDegree, FieldInDegree,
+	FieldLookups, FieldCategories, FieldUpdated}
+
+// IsField tells if <name> is an optional WikiData field.
+func IsField(name string) bool {
+	for _, f := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasField tells if <name> is in <fields>.
+func HasField(fields []string, name string) bool {
+	for _, f := range fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SummaryWidth is the (rough) max amount of runes in summaries
+// made by Summary, for articles that don't come with one.
+const SummaryWidth = 300
+
+// Summary returns the lead of <content>, i.e its first non-empty
+// paragraph (line), cut at a word boundary if it's longer than
+// <width> runes. Cut summaries end with an ellipsis.
+func Summary(content string, width int) string {
+	lead := ""
+	for _, line := range strings.Split(content, "\n") {
+		if lead = strings.TrimSpace(line); lead != "" {
+			break
+		}
+	}
+	runes := []rune(lead)
+	if len(runes) <= width {
+		return lead
+	}
+	// # Back off to the last space, unless that's most of it.
+	cut := width
+	for i := width; i > width/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	content := "\n  The universe was created last Thursday.  \nOr so they say."
+	if got := Summary(content, 100); got != "The universe was created last Thursday." {
+		t.Fatalf("unexpected summary: %s", got)
+	}
+	// # Cut at a word boundary.
+	if got := Summary(content, 16); got != "The universe was…" {
+		t.Fatalf("unexpected summary: %s", got)
+	}
+	// # No spaces to cut at.
+	if got := Summary(strings.Repeat("x", 20), 10); got != strings.Repeat("x", 10)+"…" {
+		t.Fatalf("unexpected summary: %s", got)
+	}
+}
+
+func TestIsField(t *testing.T) {
+	if !IsField(FieldSummary) || IsField("html") || IsField("") {
+		t.Fatal("unexpected IsField")
+	}
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file has helpers for title autocompletion, shared by
+// the StoredWikiManager implementations. Backends are expected
+// to find candidate titles in whatever way is efficient for them
+// and then use RankTitles for filtering and ordering.
+
+// EditDistance returns the Levenshtein distance between <a> and <b>,
+// counted in runes.
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// # Two rows of the usual DP matrix are enough.
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// MaxTypos is the amount of typos tolerated in autocomplete input
+// of a given rune length; short input is too ambiguous for any.
+func MaxTypos(n int) int {
+	switch {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	}
+	return 2
+}
+
+// Match classes of RankTitles, in order of preference.
+const (
+	matchExact = iota
+	matchPrefix
+	matchFuzzy
+)
+
+// titleRank is how well a title matches autocomplete input.
+type titleRank struct {
+	data  *WikiData
+	class int
+	typos int
+}
+
+// rankTitle ranks how well <title> matches <str> (both expected to
+// be lower-case), false is returned if it doesn't match at all.
+func rankTitle(title, str string) (int, int, bool) {
+	if title == str {
+		return matchExact, 0, true
+	}
+	if strings.HasPrefix(title, str) {
+		return matchPrefix, 0, true
+	}
+	// # Compare against the title prefix of the same length as the
+	// # input (as it's autocomplete), as well as the whole title.
+	n := utf8.RuneCountInString(str)
+	prefix := []rune(title)
+	if len(prefix) > n {
+		prefix = prefix[:n]
+	}
+	typos := EditDistance(string(prefix), str)
+	if d := EditDistance(title, str); d < typos {
+		typos = d
+	}
+	if typos > MaxTypos(n) {
+		return 0, 0, false
+	}
+	return matchFuzzy, typos, true
+}
+
+// RankTitles filters <candidates> to the ones with titles matching
+// autocomplete input <str> case-insensitively, either by prefix or
+// with a few typos (see MaxTypos). The matches are ordered: exact,
+// then prefix, then by amount of typos; ties go to shorter titles.
+// At most <limit> are returned.
+func RankTitles(str string, candidates []*WikiData, limit int) []*WikiData {
+	str = strings.ToLower(strings.TrimSpace(str))
+	ranks := make([]titleRank, 0, len(candidates))
+	if str == "" {
+		return []*WikiData{}
+	}
+	for _, c := range candidates {
+		class, typos, ok := rankTitle(strings.ToLower(c.Title), str)
+		if ok {
+			ranks = append(ranks, titleRank{data: c, class: class, typos: typos})
+		}
+	}
+	sort.SliceStable(ranks, func(i, j int) bool {
+		a, b := ranks[i], ranks[j]
+		if a.class != b.class {
+			return a.class < b.class
+		}
+		if a.typos != b.typos {
+			return a.typos < b.typos
+		}
+		if len(a.data.Title) != len(b.data.Title) {
+			return len(a.data.Title) < len(b.data.Title)
+		}
+		return a.data.Title < b.data.Title
+	})
+
+	res := make([]*WikiData, 0, len(ranks))
+	for i := 0; i < len(ranks) && i < limit; i++ {
+		res = append(res, ranks[i].data)
+	}
+	return res
+}
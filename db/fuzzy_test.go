@@ -0,0 +1,60 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"thursday", "thrusday", 2},
+		{"åäö", "aäö", 1},
+	}
+	for _, c := range cases {
+		if got := EditDistance(c.a, c.b); got != c.want {
+			t.Errorf("%v vs %v: wanted %v, got %v", c.a, c.b, c.want, got)
+		}
+	}
+}
+
+func TestRankTitles(t *testing.T) {
+	candidates := []*WikiData{
+		{ID: 1, Title: "Last Thursdayism"},
+		{ID: 2, Title: "Last"},
+		{ID: 3, Title: "Lasting"},
+		{ID: 4, Title: "Lost"},
+		{ID: 5, Title: "Unrelated"},
+		{ID: 6, Title: "Last Thursday"},
+	}
+	titles := func(data []*WikiData) string {
+		res := make([]string, 0)
+		for _, v := range data {
+			res = append(res, v.Title)
+		}
+		return fmt.Sprint(res)
+	}
+
+	got := titles(RankTitles("last", candidates, 10))
+	if got != "[Last Lasting Last Thursday Last Thursdayism Lost]" {
+		t.Fatalf("unexpected ranking: %v", got)
+	}
+	// # Typo tolerant, but only for longer input.
+	got = titles(RankTitles("last thrusday", candidates, 10))
+	if got != "[Last Thursday Last Thursdayism]" {
+		t.Fatalf("unexpected ranking: %v", got)
+	}
+	got = titles(RankTitles("lsat", candidates, 10))
+	if got != "[]" {
+		t.Fatalf("unexpected ranking: %v", got)
+	}
+	got = titles(RankTitles("LAST", candidates, 1))
+	if got != "[Last]" {
+		t.Fatalf("unexpected ranking: %v", got)
+	}
+}
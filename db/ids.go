@@ -0,0 +1,36 @@
+package db
+
+import "hash/fnv"
+
+// Articles are identified by stable ids, which (unlike internal
+// database ids) stay the same when a graph is rebuilt, so links
+// to articles keep working. An article either comes with its own
+// id (e.g a Wikipedia page id, see WikiArticle.ID), or is given
+// one based on its title, see StableID.
+
+// Max stable id, 2^53 - 1, so ids are exact as JS numbers too.
+const maxStableID = 1<<53 - 1
+
+// StableID returns the id of an article with <title>, for articles
+// that don't come with one. It's a hash of the title, so it's the
+// same across rebuilds. Collisions are very unlikely, but possible,
+// in which case stores reject the latter article.
+func StableID(title string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(title))
+	id := int64(h.Sum64() & maxStableID)
+	// # 0 means 'unset' in WikiArticle.ID.
+	if id == 0 {
+		return 1
+	}
+	return id
+}
+
+// StableID returns the id of <a>, which is a.ID if set, else
+// the StableID of a.Title.
+func (a *WikiArticle) StableID() int64 {
+	if a.ID != 0 {
+		return a.ID
+	}
+	return StableID(a.Title)
+}
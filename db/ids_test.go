@@ -0,0 +1,28 @@
+package db
+
+import "testing"
+
+func TestStableID(t *testing.T) {
+	for _, title := range []string{"", "a", "Last Thursdayism"} {
+		id := StableID(title)
+		if id <= 0 || id > maxStableID {
+			t.Fatalf("'%s': id out of range: %d", title, id)
+		}
+		if id != StableID(title) {
+			t.Fatalf("'%s': id not deterministic", title)
+		}
+	}
+	if StableID("a") == StableID("b") {
+		t.Fatal("unexpected collision")
+	}
+
+	// # Given ids are kept.
+	a := WikiArticle{ID: 42, Title: "a"}
+	if a.StableID() != 42 {
+		t.Fatalf("given id not kept: %d", a.StableID())
+	}
+	a.ID = 0
+	if a.StableID() != StableID("a") {
+		t.Fatalf("unexpected id: %d", a.StableID())
+	}
+}
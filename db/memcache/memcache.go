@@ -0,0 +1,146 @@
+package memcache
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+)
+
+// MemCacheManager implements db.CacheManager.
+var _ db.CacheManager = &MemCacheManager{}
+
+// entry is a value with an expiration, like a Redis key with a TTL.
+type entry struct {
+	v       int64
+	expires time.Time
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !now.Before(e.expires)
+}
+
+// MemCacheManager -- process-local replacement of RedisManager.
+// Meant for single-node deployments and tests, where standing
+// up Redis isn't worth it. State is lost on restart. Nothing
+// here blocks, so the ctx args go unused.
+type MemCacheManager struct {
+	mx        sync.Mutex
+	wikiIDs   map[string]entry
+	dosguard  map[string]entry
+	lastSweep time.Time
+
+	// How long to keep ip:queryid(wiki) alive.
+	// Same as in pkg redis, this is used to keep
+	// track of which Wikipedia article IDs are
+	// used by IPs for the purpose of recommendations.
+	queryIDExpiration time.Duration
+	// These two are used to prevent service
+	// spam. An IP is allowed to make x amount
+	// of requests per t amount of time, where
+	// x = dosguardAllowance and
+	// t = dosguardExpiration
+	dosguardExpiration time.Duration
+	dosguardAllowance  int
+}
+
+// New returns an empty MemCacheManager, where <conf> has the
+// expirations & allowance to use.
+func New(conf config.Cache) *MemCacheManager {
+	return &MemCacheManager{
+		wikiIDs:            make(map[string]entry),
+		dosguard:           make(map[string]entry),
+		lastSweep:          time.Now(),
+		queryIDExpiration:  conf.QueryTrackExpiration,
+		dosguardExpiration: conf.DOSGuardRefreshDelta,
+		dosguardAllowance:  conf.DOSGuardAllowancePerRefresh,
+	}
+}
+
+// Close does nothing, as there are no connections to close; it's
+// only here to satisfy db.CacheManager.
+func (m *MemCacheManager) Close() error {
+	return nil
+}
+
+// sweep drops expired entries, so IPs that are never seen again
+// don't pile up. Redis does this on its own, here it's done at
+// most once per the longest expiration. Expects m.mx to be held.
+func (m *MemCacheManager) sweep(now time.Time) {
+	delta := m.queryIDExpiration
+	if m.dosguardExpiration > delta {
+		delta = m.dosguardExpiration
+	}
+	if now.Sub(m.lastSweep) < delta {
+		return
+	}
+	for k, e := range m.wikiIDs {
+		if e.expired(now) {
+			delete(m.wikiIDs, k)
+		}
+	}
+	for k, e := range m.dosguard {
+		if e.expired(now) {
+			delete(m.dosguard, k)
+		}
+	}
+	m.lastSweep = now
+}
+
+// SetLastQueryID tries to set a query id for an ip. Intenden
+// to be used for keeping track of which Wikipedia Articles a
+// front-end client searches for, for the purpose of article
+// recommendation.
+func (m *MemCacheManager) SetLastQueryID(
+	ctx context.Context, ip string, id int64) bool {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	m.wikiIDs[ip] = entry{v: id, expires: now.Add(m.queryIDExpiration)}
+	return true
+}
+
+// LastQueryID is the counterpart of SetLastQueryID, it simply
+// tries to retrieve a Wikipedia Article for a given IP.
+func (m *MemCacheManager) LastQueryID(
+	ctx context.Context, ip string) (int64, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	e, ok := m.wikiIDs[ip]
+	if !ok || e.expired(time.Now()) {
+		return 0, false
+	}
+	return e.v, true
+}
+
+// Used to prevent service spam. Calling this method will
+// increment the counter for an IP and check if it has
+// exceeded an allowance over a time period (see fields
+// dosguardAllowance & dosguardExpiration). If True is
+// returned, then the IP is good for more requests.
+func (m *MemCacheManager) CheckRegDOSIP(
+	ctx context.Context, ip string) (bool, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	e, ok := m.dosguard[ip]
+	// # If key doesn't exist, create it with fresh allowance.
+	if !ok || e.expired(now) {
+		m.dosguard[ip] = entry{v: 1, expires: now.Add(m.dosguardExpiration)}
+		return true, nil
+	}
+	// # Allowance exceeded.
+	if int(e.v)+1 > m.dosguardAllowance {
+		return false, nil
+	}
+	// # Ok: Increment (keeping expiration, like INCR) and allow.
+	e.v++
+	m.dosguard[ip] = e
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package memcache
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wikinodes-server/config"
+)
+
+var ctx = context.Background()
+
+func TestSetGetLastQueryID(t *testing.T) {
+	m := New(config.Default().Cache)
+	ip := "0.0.0.0"
+	id := int64(1)
+
+	_, ok := m.LastQueryID(ctx, ip)
+	if ok {
+		t.Fatal("unexpected query success")
+	}
+
+	if ok := m.SetLastQueryID(ctx, ip, id); !ok {
+		t.Fatal("failed while setting k:v")
+	}
+
+	v, ok := m.LastQueryID(ctx, ip)
+	if !ok || v != id {
+		t.Fatalf("unexpected query fail: %v, %v", v, ok)
+	}
+}
+
+func TestLastQueryIDExpiration(t *testing.T) {
+	// # Reduce expiration so test is quicker.
+	conf := config.Default().Cache
+	conf.QueryTrackExpiration = time.Millisecond * 50
+
+	m := New(conf)
+	ip := "0.0.0.0"
+	m.SetLastQueryID(ctx, ip, 1)
+
+	time.Sleep(conf.QueryTrackExpiration + time.Millisecond)
+	if v, ok := m.LastQueryID(ctx, ip); ok {
+		t.Fatalf("expected expired query id, got: %v", v)
+	}
+}
+
+func TestCheckRegDOSIP(t *testing.T) {
+	ip := "0.0.0.0"
+	expire := time.Millisecond * 50
+	allow := 2
+
+	// # Reduce allowance and expiration (so test is quicker).
+	conf := config.Default().Cache
+	conf.DOSGuardRefreshDelta = expire
+	conf.DOSGuardAllowancePerRefresh = allow
+	m := New(conf)
+
+	// # Use up allowance.
+	for i := 0; i < allow; i++ {
+		if ok, err := m.CheckRegDOSIP(ctx, ip); !ok || err != nil {
+			t.Fatalf("checkreg step 1 (iter %v) fail: %v, %v", i, ok, err)
+		}
+	}
+	// # Exceed allowance
+	if ok, err := m.CheckRegDOSIP(ctx, ip); ok || err != nil {
+		t.Fatalf("checkreg step 2 fail: %v, %v", ok, err)
+	}
+	// # Other IPs are unaffected.
+	if ok, err := m.CheckRegDOSIP(ctx, "1.1.1.1"); !ok || err != nil {
+		t.Fatalf("checkreg other ip fail: %v, %v", ok, err)
+	}
+	// # Wait until ip expires.
+	time.Sleep(expire + time.Millisecond)
+	if ok, err := m.CheckRegDOSIP(ctx, ip); !ok || err != nil {
+		t.Fatalf("checkreg step 3 fail: %v, %v", ok, err)
+	}
+}
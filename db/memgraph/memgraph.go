@@ -0,0 +1,264 @@
+package memgraph
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+	"wikinodes-server/db"
+)
+
+// MemGraphManager implements db.StoredWikiManager,
+// db.StoredWikiWriter & db.StoredWikiIterator.
+var _ db.StoredWikiManager = &MemGraphManager{}
+var _ db.StoredWikiWriter = &MemGraphManager{}
+var _ db.StoredWikiIterator = &MemGraphManager{}
+
+// article is the in-memory counterpart of a WikiData node.
+type article struct {
+	id       int64
+	legacyID *int64
+	title    string
+	content  string
+	html     string
+
+	summary    string
+	categories []string
+	updated    time.Time
+}
+
+// MemGraphManager -- keeps articles and their HYPERLINKS
+// relationships in process memory. Intended for running
+// the server without Neo4j (dev, tests, small demo graphs).
+type MemGraphManager struct {
+	mx       sync.RWMutex
+	nextID   int64
+	articles map[int64]*article
+	// # Keeps insertion order, so results are deterministic
+	// # where Neo4j would be (roughly) deterministic as well.
+	order []int64
+	// # title -> ids, titles aren't necessarily unique.
+	titles map[string][]int64
+	// # legacy id -> id.
+	legacy map[int64]int64
+	// # from id -> to id -> lookups.
+	rels map[int64]map[int64]int64
+
+	// # rand.Rand isn't safe for concurrent use, so it gets
+	// # its own lock (reads only hold mx.RLock).
+	rmx sync.Mutex
+	rng *rand.Rand
+}
+
+// New returns an empty MemGraphManager.
+func New() *MemGraphManager {
+	return &MemGraphManager{
+		articles: make(map[int64]*article),
+		order:    make([]int64, 0),
+		titles:   make(map[string][]int64),
+		legacy:   make(map[int64]int64),
+		rels:     make(map[int64]map[int64]int64),
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// AddArticle adds an article and returns the id it was given. Unlike
+// AddArticles, ids are sequential and titles needn't be unique, which
+// is handy for tests.
+func (m *MemGraphManager) AddArticle(title, content, html string) int64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.nextID++
+	// # Skip ids taken by AddArticles.
+	for m.articles[m.nextID] != nil {
+		m.nextID++
+	}
+	m.addArticle(&article{
+		id: m.nextID, title: title, content: content, html: html,
+		summary: db.Summary(content, db.SummaryWidth), updated: time.Now()})
+	return m.nextID
+}
+
+// addArticle adds <a> as is, without locking.
+func (m *MemGraphManager) addArticle(a *article) {
+	m.articles[a.id] = a
+	m.order = append(m.order, a.id)
+	m.titles[a.title] = append(m.titles[a.title], a.id)
+	if a.legacyID != nil {
+		m.legacy[*a.legacyID] = a.id
+	}
+}
+
+// AddRel adds a HYPERLINKS relationship from the article
+// with vID to the article with wID. False is returned if
+// either of the articles doesn't exist. Adding an already
+// existing relationship is a no-op.
+func (m *MemGraphManager) AddRel(vID, wID int64) bool {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.addRel(vID, wID)
+}
+
+// addRel is AddRel without locking.
+func (m *MemGraphManager) addRel(vID, wID int64) bool {
+	if m.articles[vID] == nil || m.articles[wID] == nil {
+		return false
+	}
+	if m.rels[vID] == nil {
+		m.rels[vID] = make(map[int64]int64)
+	}
+	if _, ok := m.rels[vID][wID]; !ok {
+		m.rels[vID][wID] = 0
+	}
+	return true
+}
+
+// AddArticles adds articles in one go, keyed by title. So
+// adding an article with a title that already exists will
+// update the content, html, summary and categories of the
+// existing one (which keeps its id). New articles get their
+// StableID as id, where an id that is taken is an error, like
+// with a uniqueness constraint in Neo4j.
+func (m *MemGraphManager) AddArticles(
+	ctx context.Context, articles []*db.WikiArticle) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for _, a := range articles {
+		ids := m.titles[a.Title]
+		if len(ids) == 0 {
+			id := a.StableID()
+			if other, ok := m.articles[id]; ok {
+				return fmt.Errorf("article '%s': id %d is taken by '%s'",
+					a.Title, id, other.title)
+			}
+			m.addArticle(&article{id: id, legacyID: a.LegacyID,
+				title: a.Title, content: a.Content, html: a.HTML,
+				summary: a.SummaryOrLead(), categories: a.Categories,
+				updated: time.Now()})
+			continue
+		}
+		// # Same as MERGE; all matches are updated.
+		for _, id := range ids {
+			m.articles[id].content = a.Content
+			m.articles[id].html = a.HTML
+			m.articles[id].summary = a.SummaryOrLead()
+			m.articles[id].categories = a.Categories
+			m.articles[id].updated = time.Now()
+			if a.LegacyID != nil {
+				m.articles[id].legacyID = a.LegacyID
+				m.legacy[*a.LegacyID] = id
+			}
+		}
+	}
+	return nil
+}
+
+// AddRels adds HYPERLINKS relationships in one go, where
+// articles are referred to by title. Rels that refer to
+// non-existent articles are skipped. If Lookups is set on
+// a rel, then it overwrites the stored weight.
+func (m *MemGraphManager) AddRels(
+	ctx context.Context, rels []*db.WikiRel) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for _, r := range rels {
+		for _, vID := range m.titles[r.From] {
+			for _, wID := range m.titles[r.To] {
+				m.addRel(vID, wID)
+				if r.Lookups > 0 {
+					m.rels[vID][wID] = r.Lookups
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// EachArticle calls <f> for every article, in insertion order.
+// If <full> is false, then content & html are left empty.
+// Iteration stops at the first error returned by <f>, that
+// error is then returned.
+func (m *MemGraphManager) EachArticle(
+	ctx context.Context, full bool, f func(*db.WikiArticle) error,
+) error {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	for _, id := range m.order {
+		// # Exports can be long, so ctx is checked as they go.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		a := m.articles[id]
+		wa := db.WikiArticle{ID: a.id, LegacyID: a.legacyID, Title: a.title}
+		if full {
+			wa.Content, wa.HTML = a.content, a.html
+			wa.Summary, wa.Categories = a.summary, a.categories
+		}
+		if err := f(&wa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EachRel calls <f> for every HYPERLINKS relationship, where
+// iteration stops the same way as with EachArticle.
+func (m *MemGraphManager) EachRel(
+	ctx context.Context, f func(*db.WikiRel) error) error {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	for _, vID := range m.order {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, wID := range m.sortedNeighs(vID) {
+			err := f(&db.WikiRel{
+				From:    m.articles[vID].title,
+				To:      m.articles[wID].title,
+				Lookups: m.rels[vID][wID],
+				FromID:  vID,
+				ToID:    wID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close does nothing, as there are no connections to close; it's
+// only here to satisfy db.StoredWikiManager.
+func (m *MemGraphManager) Close() error {
+	return nil
+}
+
+// randFloat64 is a concurrency-safe rng.Float64.
+func (m *MemGraphManager) randFloat64() float64 {
+	m.rmx.Lock()
+	defer m.rmx.Unlock()
+	return m.rng.Float64()
+}
+
+// randSample is a concurrency-safe db.SampleIDs with rng.
+func (m *MemGraphManager) randSample(ids []int64, n int) []int64 {
+	m.rmx.Lock()
+	defer m.rmx.Unlock()
+	return db.SampleIDs(ids, n, m.rng)
+}
+
+// wikiData converts an article into db.WikiData.
+func (a *article) wikiData() *db.WikiData {
+	return &db.WikiData{ID: a.id, Title: a.title}
+}
@@ -0,0 +1,529 @@
+package memgraph
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"wikinodes-server/db"
+)
+
+var ctx = context.Background()
+
+func TestSearchArticlesByTitle(t *testing.T) {
+	m := New()
+	title, content, html := "a", "", ""
+	m.AddArticle(title, content, html)
+	data, err := m.SearchArticlesByTitle(ctx, title, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Fatal("empty result")
+	}
+	if data[0].Title != title {
+		t.Fatal("unexpected result: ", data[0].Title)
+	}
+}
+
+func TestSearchArticlesByContent(t *testing.T) {
+	m := New()
+	m.AddArticle("a", "b", "c")
+	m.AddArticle("x", "b b B", "z")
+	m.AddArticle("y", "nothing", "z")
+
+	res, err := m.SearchArticlesByContent(ctx, "b", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatal("unexpected result len: ", len(res))
+	}
+	// # Most occurrences first.
+	if res[0].Title != "x" || res[1].Title != "a" {
+		t.Fatalf("got incorrect result: %v, %v", res[0].Title, res[1].Title)
+	}
+
+	res, _ = m.SearchArticlesByContent(ctx, "b", 0, 1)
+	if len(res) != 1 {
+		t.Fatal("limit not respected")
+	}
+	if res[0].Score != 3 || res[0].Snippet != "<mark>b</mark> <mark>b</mark> <mark>B</mark>" {
+		t.Fatalf("unexpected score/snippet: %v, %v", res[0].Score, res[0].Snippet)
+	}
+}
+
+func TestSearchArticlesByID(t *testing.T) {
+	m := New()
+	title := "a"
+	id := m.AddArticle(title, "", "")
+
+	res, err := m.SearchArticlesByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Title != title {
+		t.Fatal("unexpected id result")
+	}
+
+	res, _ = m.SearchArticlesByID(ctx, id+1)
+	if len(res) != 0 {
+		t.Fatal("expected empty result for unknown id")
+	}
+}
+
+func TestSearchArticlesNeighsByID(t *testing.T) {
+	m := New()
+	vID := m.AddArticle("v", "", "")
+	wID := m.AddArticle("w", "", "")
+	m.AddRel(vID, wID)
+
+	res, _ := m.SearchArticlesNeighsByID(ctx, vID, 1)
+	if len(res) == 0 || res[0].Title != "w" {
+		t.Fatal("did not get neighbour")
+	}
+	// # Order matters.
+	res, _ = m.SearchArticlesNeighsByID(ctx, wID, 1)
+	if len(res) != 0 {
+		t.Fatal("got neighbour in wrong direction")
+	}
+}
+
+func TestSearchArticlesHTMLByID(t *testing.T) {
+	m := New()
+	html := "some content"
+	id := m.AddArticle("v", "", html)
+
+	res, _ := m.SearchArticlesHTMLByID(ctx, id)
+	if res != html {
+		t.Fatal("expected html, got: " + res)
+	}
+}
+
+func TestCheckRelsExistByIDs(t *testing.T) {
+	m := New()
+	vID := m.AddArticle("v", "", "")
+	wID := m.AddArticle("w", "", "")
+
+	r1, _ := m.CheckRelsExistByIDs(ctx, [][2]int64{{vID, wID}})
+	if r1[0] == true {
+		t.Fatal("rel check should be false")
+	}
+
+	m.AddRel(vID, wID)
+	r2, _ := m.CheckRelsExistByIDs(ctx, [][2]int64{{vID, wID}, {wID, vID}})
+	if r2[0] == false {
+		t.Fatal("rel check should be true")
+	}
+	if r2[1] == true {
+		t.Fatal("reversed rel check should be false")
+	}
+}
+
+func TestCheckRelsByIDs(t *testing.T) {
+	m := New()
+	vID := m.AddArticle("v", "", "")
+	wID := m.AddArticle("w", "", "")
+	m.AddRel(vID, wID)
+	m.IncrementRel(ctx, vID, wID)
+
+	res, err := m.CheckRelsByIDs(ctx, [][2]int64{{vID, wID}, {wID, vID}})
+	if err != nil || len(res) != 2 {
+		t.Fatalf("unexpected result: %v, %v", err, res)
+	}
+	if !res[0].Exists || res[0].Lookups != 1 || res[1].Exists || res[1].Lookups != 0 {
+		t.Fatalf("unexpected checks: %+v", res)
+	}
+}
+
+func TestSearchRelsAmongIDs(t *testing.T) {
+	m := New()
+	a := m.AddArticle("a", "", "")
+	b := m.AddArticle("b", "", "")
+	c := m.AddArticle("c", "", "")
+	m.AddRel(a, b)
+	m.AddRel(b, a)
+	m.AddRel(b, c)
+	m.IncrementRel(ctx, b, a)
+
+	// # c is left out, so b -> c is too. Duplicates are ignored.
+	res, err := m.SearchRelsAmongIDs(ctx, []int64{a, b, a, 12345})
+	want := [][3]int64{{a, b, 0}, {b, a, 1}}
+	if err != nil || fmt.Sprint(res) != fmt.Sprint(want) {
+		t.Fatalf("wanted %v, got %v, %v", want, res, err)
+	}
+}
+
+func TestRandomArticles(t *testing.T) {
+	m := New()
+
+	// # Create a number of titles and use them for node creation
+	titles := make([]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		titles = append(titles, fmt.Sprintf("%v", i))
+	}
+	for _, title := range titles {
+		m.AddArticle(title, "", "")
+	}
+
+	// # Check for thrice in a row, should be unlikely
+	matches := 0
+	for i := 0; i < 3; i++ {
+		res, _ := m.RandomArticles(ctx, 1)
+		if res[0].Title == titles[5] { // # 5 is arbitrary.
+			matches += 1
+		}
+	}
+	if matches == 3 {
+		t.Fatal("unlikely result (same 3 times in a row)")
+	}
+
+	res, _ := m.RandomArticles(ctx, 100)
+	if len(res) != len(titles) {
+		t.Fatal("expected all articles, got: ", len(res))
+	}
+}
+
+func TestSampleArticles(t *testing.T) {
+	m := New()
+	hub := m.AddArticle("hub", "", "")
+	leaves := make([]int64, 0, 10)
+	for i := 0; i < 10; i++ {
+		leaf := m.AddArticle(fmt.Sprintf("%v", i), "", "")
+		m.AddRel(hub, leaf)
+		leaves = append(leaves, leaf)
+	}
+	// # The first 3 leaves are linked by all others.
+	for _, v := range leaves[3:] {
+		for _, w := range leaves[:3] {
+			m.AddRel(v, w)
+		}
+	}
+
+	ids := func(data []*db.WikiData) []int64 {
+		res := make([]int64, 0, len(data))
+		for _, d := range data {
+			res = append(res, d.ID)
+		}
+		return res
+	}
+
+	// # Same seed, same sample, in the same order.
+	seed := int64(42)
+	opts := db.SampleOptions{Amount: 5, Seed: &seed}
+	a, _ := m.SampleArticles(ctx, opts)
+	b, _ := m.SampleArticles(ctx, opts)
+	if len(a) != 5 || !reflect.DeepEqual(ids(a), ids(b)) {
+		t.Fatalf("expected the same sample: %v, %v", ids(a), ids(b))
+	}
+
+	res, _ := m.SampleArticles(ctx, db.SampleOptions{Amount: 100, NeighOf: &hub})
+	if len(res) != len(leaves) {
+		t.Fatal("expected all neighbours, got: ", len(res))
+	}
+	res, _ = m.SampleArticles(ctx, db.SampleOptions{Amount: 100, MinInDegree: 2})
+	sorted := ids(res)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if !reflect.DeepEqual(sorted, leaves[:3]) {
+		t.Fatalf("expected the well-linked leaves, got: %v", sorted)
+	}
+	// # Filters combine.
+	res, _ = m.SampleArticles(ctx, db.SampleOptions{
+		Amount: 100, NeighOf: &leaves[5], MinInDegree: 8})
+	if len(res) != 3 {
+		t.Fatal("expected 3 articles, got: ", len(res))
+	}
+	res, _ = m.SampleArticles(ctx, db.SampleOptions{Amount: 100, NeighOf: &leaves[0]})
+	if len(res) != 0 {
+		t.Fatal("expected no articles, got: ", len(res))
+	}
+}
+
+func TestIncrementRelAndSearchArticlesNeighsByID(t *testing.T) {
+	m := New()
+	// # rel: q -> a,b,c
+	titles := []string{"q", "a", "b", "c"}
+	ids := make([]int64, 4)
+	for i, v := range titles {
+		ids[i] = m.AddArticle(v, "", "")
+	}
+	for _, id := range ids[1:] {
+		m.AddRel(ids[0], id)
+	}
+	// # Incr rels such that best-fit should be in order: a,b,c
+	for i := 0; i < 200; i++ {
+		m.IncrementRel(ctx, ids[0], ids[1])
+	}
+	for i := 0; i < 100; i++ {
+		m.IncrementRel(ctx, ids[0], ids[2])
+	}
+	// # Weighting is random, so count how often each title comes
+	// # first instead of relying on a single (flaky) ordering.
+	firsts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		res, _ := m.SearchArticlesNeighsByID(ctx, ids[0], 3)
+		if len(res) != 3 {
+			t.Fatal("unexpected result len: ", len(res))
+		}
+		firsts[res[0].Title]++
+	}
+	if firsts["a"] <= firsts["b"] || firsts["b"] <= firsts["c"] {
+		t.Errorf("wanted a,b,c to be preferred in that order, got %v", firsts)
+	}
+}
+
+func TestSearchArticlesPathByIDs(t *testing.T) {
+	m := New()
+	// # rel: a -> b -> c -> d, a -> x -> d
+	titles := []string{"a", "b", "c", "d", "x"}
+	ids := make(map[string]int64)
+	for _, v := range titles {
+		ids[v] = m.AddArticle(v, "", "")
+	}
+	m.AddRel(ids["a"], ids["b"])
+	m.AddRel(ids["b"], ids["c"])
+	m.AddRel(ids["c"], ids["d"])
+	m.AddRel(ids["a"], ids["x"])
+	m.AddRel(ids["x"], ids["d"])
+
+	res, _ := m.SearchArticlesPathByIDs(ctx, ids["a"], ids["d"], 5)
+	if len(res) != 3 || res[0].Title != "a" ||
+		res[1].Title != "x" || res[2].Title != "d" {
+		t.Fatalf("unexpected path: %v", res)
+	}
+	// # Too shallow.
+	res, _ = m.SearchArticlesPathByIDs(ctx, ids["a"], ids["d"], 1)
+	if len(res) != 0 {
+		t.Fatalf("expected no path, got: %v", res)
+	}
+	// # Order matters.
+	res, _ = m.SearchArticlesPathByIDs(ctx, ids["d"], ids["a"], 5)
+	if len(res) != 0 {
+		t.Fatalf("expected no path, got: %v", res)
+	}
+	// # Same start and end.
+	res, _ = m.SearchArticlesPathByIDs(ctx, ids["a"], ids["a"], 5)
+	if len(res) != 1 || res[0].Title != "a" {
+		t.Fatalf("unexpected path: %v", res)
+	}
+}
+
+func TestSearchSubgraphByID(t *testing.T) {
+	m := New()
+	// # rel: a -> b,c,d; b -> e; c -> a; e -> a
+	titles := []string{"a", "b", "c", "d", "e"}
+	ids := make(map[string]int64)
+	for _, v := range titles {
+		ids[v] = m.AddArticle(v, "", "")
+	}
+	m.AddRel(ids["a"], ids["b"])
+	m.AddRel(ids["a"], ids["c"])
+	m.AddRel(ids["a"], ids["d"])
+	m.AddRel(ids["b"], ids["e"])
+	m.AddRel(ids["c"], ids["a"])
+	m.AddRel(ids["e"], ids["a"])
+	// # Make c the preferred neighbour of a.
+	m.IncrementRel(ctx, ids["a"], ids["c"])
+
+	// # Depth 1, limit 2: a plus its two best neighbours (c, b).
+	res, _ := m.SearchSubgraphByID(ctx, ids["a"], 1, 2)
+	got := make([]string, 0)
+	for _, v := range res.Nodes {
+		got = append(got, v.Title)
+	}
+	if fmt.Sprint(got) != "[a c b]" {
+		t.Fatalf("unexpected nodes: %v", got)
+	}
+	// # Edges among a,b,c: a->b, a->c (lookups 1), c->a.
+	want := [][3]int64{
+		{ids["a"], ids["b"], 0}, {ids["a"], ids["c"], 1}, {ids["c"], ids["a"], 0}}
+	if fmt.Sprint(res.Edges) != fmt.Sprint(want) {
+		t.Fatalf("unexpected edges: %v, wanted %v", res.Edges, want)
+	}
+
+	// # Depth 2 reaches e through b.
+	res, _ = m.SearchSubgraphByID(ctx, ids["a"], 2, 10)
+	if len(res.Nodes) != 5 || len(res.Edges) != 6 {
+		t.Fatalf("unexpected subgraph: %v, %v", res.Nodes, res.Edges)
+	}
+
+	// # Unknown article.
+	res, _ = m.SearchSubgraphByID(ctx, 0, 2, 10)
+	if len(res.Nodes) != 0 || len(res.Edges) != 0 {
+		t.Fatal("expected empty subgraph")
+	}
+}
+
+func TestSearchArticlesBacklinksByID(t *testing.T) {
+	m := New()
+	// # rel: v -> w, x -> w
+	vID := m.AddArticle("v", "", "")
+	wID := m.AddArticle("w", "", "")
+	xID := m.AddArticle("x", "", "")
+	m.AddRel(vID, wID)
+	m.AddRel(xID, wID)
+
+	res, _ := m.SearchArticlesBacklinksByID(ctx, wID, 10)
+	if len(res) != 2 {
+		t.Fatalf("unexpected backlinks: %v", res)
+	}
+	res, _ = m.SearchArticlesBacklinksByID(ctx, wID, 1)
+	if len(res) != 1 {
+		t.Fatal("limit not respected")
+	}
+	// # Order matters.
+	res, _ = m.SearchArticlesBacklinksByID(ctx, vID, 10)
+	if len(res) != 0 {
+		t.Fatal("got backlink in wrong direction")
+	}
+}
+
+func TestSearchArticlesByContentOffset(t *testing.T) {
+	m := New()
+	for i := 0; i < 5; i++ {
+		// # Article i has 5-i matches, so results are ordered by i.
+		m.AddArticle(fmt.Sprint(i), strings.Repeat("x ", 5-i), "")
+	}
+	got := make([]string, 0)
+	for offset := 0; offset < 6; offset += 2 {
+		res, _ := m.SearchArticlesByContent(ctx, "x", offset, 2)
+		for _, v := range res {
+			got = append(got, v.Title)
+		}
+	}
+	if fmt.Sprint(got) != "[0 1 2 3 4]" {
+		t.Fatalf("unexpected pages: %v", got)
+	}
+
+	// # Same for titles, which keep insertion order.
+	for i := 0; i < 3; i++ {
+		m.AddArticle("dup", "", "")
+	}
+	res, _ := m.SearchArticlesByTitle(ctx, "dup", 1, 10)
+	if len(res) != 2 {
+		t.Fatalf("unexpected title page: %v", res)
+	}
+}
+
+func TestSearchArticlesByTitleFuzzy(t *testing.T) {
+	m := New()
+	for _, title := range []string{"Last Thursdayism", "Lasagna", "Last"} {
+		m.AddArticle(title, "", "")
+	}
+	res, _ := m.SearchArticlesByTitleFuzzy(ctx, "last thursdya", 10)
+	if len(res) != 1 || res[0].Title != "Last Thursdayism" {
+		t.Fatalf("unexpected result: %v", res)
+	}
+	res, _ = m.SearchArticlesByTitleFuzzy(ctx, "LAS", 10)
+	if len(res) != 3 || res[0].Title != "Last" {
+		t.Fatalf("unexpected result: %v", res)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	m := New()
+	id := m.AddArticle("a", "", "")
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := m.SearchArticlesByID(cctx, id); err != context.Canceled {
+		t.Fatalf("expected cancel err, got: %v", err)
+	}
+	err := m.EachArticle(cctx, false, func(*db.WikiArticle) error { return nil })
+	if err != context.Canceled {
+		t.Fatalf("expected cancel err, got: %v", err)
+	}
+}
+
+func TestAddArticlesStableIDs(t *testing.T) {
+	m := New()
+	legacy := int64(7)
+	err := m.AddArticles(ctx, []*db.WikiArticle{
+		{Title: "a"},
+		{ID: 42, LegacyID: &legacy, Title: "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := m.SearchArticlesByTitle(ctx, "a", 0, 1)
+	b, _ := m.SearchArticlesByTitle(ctx, "b", 0, 1)
+	if len(a) != 1 || a[0].ID != db.StableID("a") || len(b) != 1 || b[0].ID != 42 {
+		t.Fatalf("unexpected ids: %v, %v", a, b)
+	}
+
+	res, err := m.SearchArticlesByLegacyID(ctx, legacy)
+	if err != nil || len(res) != 1 || res[0].ID != 42 {
+		t.Fatalf("unexpected legacy result: %v, %v", err, res)
+	}
+	if res, _ := m.SearchArticlesByLegacyID(ctx, 8); len(res) != 0 {
+		t.Fatalf("unexpected legacy result: %v", res)
+	}
+
+	// # Same id, different title.
+	err = m.AddArticles(ctx, []*db.WikiArticle{{ID: 42, Title: "c"}})
+	if err == nil {
+		t.Fatal("expected id collision err")
+	}
+}
+
+func TestFillArticleFields(t *testing.T) {
+	m := New()
+	a := m.AddArticle("a", "\nLead of a.\nMore.", "")
+	b := m.AddArticle("b", "", "")
+	c := m.AddArticle("c", "", "")
+	m.AddRel(a, b)
+	m.AddRel(a, c)
+	m.AddRel(c, b)
+	m.IncrementRel(ctx, a, b)
+	m.IncrementRel(ctx, c, b)
+	m.AddArticles(ctx, []*db.WikiArticle{{Title: "c", Categories: []string{"x"}}})
+
+	data := []*db.WikiData{{ID: a}, {ID: b}, {ID: c}, {ID: 12345}}
+	err := m.FillArticleFields(ctx, data, db.Fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0].Summary != "Lead of a." || *data[0].OutDegree != 2 ||
+		*data[0].InDegree != 0 || data[0].Updated == nil {
+		t.Fatalf("unexpected a: %+v", data[0])
+	}
+	if *data[1].InDegree != 2 || *data[1].Lookups != 2 {
+		t.Fatalf("unexpected b: %+v", data[1])
+	}
+	if len(data[2].Categories) != 1 || data[2].Categories[0] != "x" {
+		t.Fatalf("unexpected c: %+v", data[2])
+	}
+	if data[3].OutDegree != nil {
+		t.Fatalf("expected missing article to be left as is: %+v", data[3])
+	}
+
+	// # Only what's asked for.
+	data = []*db.WikiData{{ID: a}}
+	m.FillArticleFields(ctx, data, []string{db.FieldInDegree})
+	if data[0].InDegree == nil || data[0].OutDegree != nil || data[0].Summary != "" {
+		t.Fatalf("unexpected fields: %+v", data[0])
+	}
+}
+
+func TestLookupArticles(t *testing.T) {
+	m := New()
+	a := m.AddArticle("a", "", "")
+	m.AddArticle("a", "", "")
+	b := m.AddArticle("b", "", "")
+
+	res, err := m.LookupArticles(ctx, []int64{a, 12345, b}, []string{"a", "nope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ByID) != 2 || res.ByID[a].Title != "a" || res.ByID[b].Title != "b" {
+		t.Fatalf("unexpected byId: %v", res.ByID)
+	}
+	if len(res.ByTitle) != 1 || res.ByTitle["a"].ID != a {
+		t.Fatalf("unexpected byTitle: %v", res.ByTitle)
+	}
+	if fmt.Sprint(res.MissingIDs, res.MissingTitles) != "[12345] [nope]" {
+		t.Fatalf("unexpected missing: %v, %v", res.MissingIDs, res.MissingTitles)
+	}
+}
@@ -0,0 +1,586 @@
+package memgraph
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"wikinodes-server/db"
+)
+
+// This file contains exported funcs (the API)
+// of this pkg -- they query the in-memory graph.
+// The purpose is to satisfy the db.StoredWikiManager
+// behaviour in db/protocols.go, mirroring what the
+// neo4j pkg does with Cypher. Queries are quick
+// on a graph this small, so ctx is only checked
+// before starting.
+
+// SearchArticlesByID will search through articles
+// by their IDs and return all matches.
+func (m *MemGraphManager) SearchArticlesByID(
+	ctx context.Context, id int64) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	res := make([]*db.WikiData, 0, 1) // # 1 is logically expected.
+	if a, ok := m.articles[id]; ok {
+		res = append(res, a.wikiData())
+	}
+	return res, nil
+}
+
+// SearchArticlesByLegacyID will search through articles by
+// the ids they had before stable ids, see db.StableID.
+func (m *MemGraphManager) SearchArticlesByLegacyID(
+	ctx context.Context, legacyID int64) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	res := make([]*db.WikiData, 0, 1)
+	if id, ok := m.legacy[legacyID]; ok {
+		res = append(res, m.articles[id].wikiData())
+	}
+	return res, nil
+}
+
+// LookupArticles looks up articles by <ids> and <titles> in one
+// go, see db.WikiLookup.
+func (m *MemGraphManager) LookupArticles(
+	ctx context.Context, ids []int64, titles []string) (*db.WikiLookup, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	found := make([]*db.WikiData, 0, len(ids)+len(titles))
+	for _, id := range ids {
+		if a, ok := m.articles[id]; ok {
+			found = append(found, a.wikiData())
+		}
+	}
+	for _, title := range titles {
+		for _, id := range m.titles[title] {
+			found = append(found, m.articles[id].wikiData())
+		}
+	}
+	return db.NewWikiLookup(ids, titles, found), nil
+}
+
+// SearchArticlesByTitle will search through articles by their
+// title and return matches, skipping the first <offset> ones
+// and returning at most <limit>.
+func (m *MemGraphManager) SearchArticlesByTitle(
+	ctx context.Context, title string, offset, limit int) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	ids := window(m.titles[title], offset, limit)
+	res := make([]*db.WikiData, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, m.articles[id].wikiData())
+	}
+	return res, nil
+}
+
+// SearchArticlesByTitleFuzzy is meant for autocompletion, it
+// will search through articles by title, case-insensitively,
+// where titles can match either by prefix or with a few typos.
+// See db.RankTitles for details on matching and ordering.
+func (m *MemGraphManager) SearchArticlesByTitleFuzzy(
+	ctx context.Context, str string, limit int) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	// # The memory store is small, so all titles are candidates.
+	candidates := make([]*db.WikiData, 0, len(m.order))
+	for _, id := range m.order {
+		candidates = append(candidates, m.articles[id].wikiData())
+	}
+	return db.RankTitles(str, candidates, limit), nil
+}
+
+// SearchArticlesByContent will do a full-text search through the
+// article content. Unlike the Neo4j index this isn't Lucene, the
+// terms of the search string (see db.SearchTerms) are simply ranked
+// by how many times they occur (case-insensitive). The first <offset>
+// results are skipped, at most <limit> are returned.
+func (m *MemGraphManager) SearchArticlesByContent(
+	ctx context.Context, str string, offset, limit int) ([]*db.WikiSearchHit, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	terms := db.SearchTerms(str)
+	hits := make([]*db.WikiSearchHit, 0)
+	content := make(map[int64]string)
+	for _, id := range m.order {
+		a := m.articles[id]
+		lower := strings.ToLower(a.content)
+		score := 0
+		for _, term := range terms {
+			score += strings.Count(lower, term)
+		}
+		if score > 0 {
+			hits = append(hits, &db.WikiSearchHit{
+				WikiData: *a.wikiData(), Score: float64(score)})
+			content[id] = a.content
+		}
+	}
+	// # Stable, so equal scores keep insertion order.
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+
+	hits = hits[clamp(offset, len(hits)):]
+	hits = hits[:clamp(limit, len(hits))]
+	// # Snippets only for what's returned.
+	for _, hit := range hits {
+		hit.Snippet = db.Snippet(content[hit.ID], str, db.SnippetWidth)
+	}
+	return hits, nil
+}
+
+// SearchArticlesNeighsByID will search for article 'A'
+// by its ID and return articles that were linked from 'A'.
+// Order is random, weighted by the 'lookups' of each link.
+func (m *MemGraphManager) SearchArticlesNeighsByID(
+	ctx context.Context, id int64, limit int) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	return m.weightedPick(m.rels[id], limit), nil
+}
+
+// SearchArticlesBacklinksByID will search for article 'A'
+// by its ID and return articles that link to 'A'. Order
+// is random, weighted by the 'lookups' of each link.
+func (m *MemGraphManager) SearchArticlesBacklinksByID(
+	ctx context.Context, id int64, limit int) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	// # No reverse index, the memory store is meant to be small.
+	backlinks := make(map[int64]int64)
+	for vID, neighs := range m.rels {
+		if lookups, ok := neighs[id]; ok {
+			backlinks[vID] = lookups
+		}
+	}
+	return m.weightedPick(backlinks, limit), nil
+}
+
+// SearchSubgraphByID will search for article 'A' by its ID
+// and return the articles within <depth> links from 'A' (by
+// following HYPERLINKS outwards), along with all HYPERLINKS
+// among those articles. At most <limit> articles are added
+// per level, where links with more lookups are preferred.
+func (m *MemGraphManager) SearchSubgraphByID(
+	ctx context.Context, id int64, depth, limit int) (*db.WikiGraph, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	res := &db.WikiGraph{Nodes: make([]*db.WikiData, 0), Edges: make([][3]int64, 0)}
+	if m.articles[id] == nil {
+		return res, nil
+	}
+	res.Nodes = append(res.Nodes, m.articles[id].wikiData())
+
+	// # Expand level by level, where frontier is the previous level.
+	// # A candidate's weight is its most looked up incoming link.
+	seen := map[int64]bool{id: true}
+	frontier := []int64{id}
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		weights := make(map[int64]int64)
+		for _, vID := range frontier {
+			for wID, lookups := range m.rels[vID] {
+				if w, ok := weights[wID]; !seen[wID] && (!ok || lookups > w) {
+					weights[wID] = lookups
+				}
+			}
+		}
+		next := make([]int64, 0, len(weights))
+		for wID := range weights {
+			next = append(next, wID)
+		}
+		sort.Slice(next, func(i, j int) bool {
+			if weights[next[i]] != weights[next[j]] {
+				return weights[next[i]] > weights[next[j]]
+			}
+			return next[i] < next[j]
+		})
+		next = next[:clamp(limit, len(next))]
+		for _, wID := range next {
+			seen[wID] = true
+			res.Nodes = append(res.Nodes, m.articles[wID].wikiData())
+		}
+		frontier = next
+	}
+
+	// # All edges among the collected articles.
+	ids := make([]int64, len(res.Nodes))
+	for i, v := range res.Nodes {
+		ids[i] = v.ID
+	}
+	res.Edges = m.relsAmong(ids)
+	return res, nil
+}
+
+// SearchArticlesHTMLByID will get the HTML from an article
+// with the specified ID.
+func (m *MemGraphManager) SearchArticlesHTMLByID(
+	ctx context.Context, id int64) (string, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	if a, ok := m.articles[id]; ok {
+		return a.html, nil
+	}
+	return "", nil
+}
+
+// SearchArticlesPathByIDs will search for the shortest chain
+// of articles that link (HYPERLINKS) from article 'A' to 'B',
+// by their IDs. The chain can be at most <maxDepth> links long.
+// The result starts with 'A' and ends with 'B', it is empty if
+// there is no such chain.
+func (m *MemGraphManager) SearchArticlesPathByIDs(
+	ctx context.Context, fromID, toID int64, maxDepth int) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	res := make([]*db.WikiData, 0)
+	if m.articles[fromID] == nil || m.articles[toID] == nil {
+		return res, nil
+	}
+	// # BFS, level by level, keeping track of where each
+	// # article was reached from so the path can be traced.
+	prev := map[int64]int64{fromID: fromID}
+	frontier := []int64{fromID}
+	for depth := 0; depth < maxDepth; depth++ {
+		if _, found := prev[toID]; found {
+			break
+		}
+		next := make([]int64, 0)
+		for _, vID := range frontier {
+			for _, wID := range m.sortedNeighs(vID) {
+				if _, seen := prev[wID]; !seen {
+					prev[wID] = vID
+					next = append(next, wID)
+				}
+			}
+		}
+		frontier = next
+	}
+	if _, ok := prev[toID]; !ok {
+		return res, nil
+	}
+	// # Trace back from 'B' and reverse.
+	for id := toID; ; id = prev[id] {
+		res = append(res, m.articles[id].wikiData())
+		if id == fromID {
+			break
+		}
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res, nil
+}
+
+// CheckRelsExistByIDs will check if there is a relationship
+// between articles, i.e if one links another. See the docs
+// of db.StoredWikiManager for details.
+func (m *MemGraphManager) CheckRelsExistByIDs(
+	ctx context.Context, relIDs [][2]int64) ([]bool, error,
+) {
+	checks, err := m.CheckRelsByIDs(ctx, relIDs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]bool, len(checks))
+	for i, c := range checks {
+		res[i] = c.Exists
+	}
+	return res, nil
+}
+
+// CheckRelsByIDs is like CheckRelsExistByIDs, but with the
+// lookups weight of each relationship.
+func (m *MemGraphManager) CheckRelsByIDs(
+	ctx context.Context, relIDs [][2]int64) ([]db.WikiRelCheck, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	res := make([]db.WikiRelCheck, len(relIDs))
+	for i, rel := range relIDs {
+		res[i].Lookups, res[i].Exists = m.rels[rel[0]][rel[1]]
+	}
+	return res, nil
+}
+
+// SearchRelsAmongIDs returns all HYPERLINKS relationships among
+// the articles with <ids>, of form [from id, to id, lookups].
+func (m *MemGraphManager) SearchRelsAmongIDs(
+	ctx context.Context, ids []int64) ([][3]int64, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	return m.relsAmong(ids), nil
+}
+
+// relsAmong is SearchRelsAmongIDs without locking. Edges are ordered
+// by <ids>, then by neighbour id.
+func (m *MemGraphManager) relsAmong(ids []int64) [][3]int64 {
+	in := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		in[id] = true
+	}
+	res := make([][3]int64, 0)
+	for _, vID := range ids {
+		// # Once per id, even if given twice.
+		if !in[vID] {
+			continue
+		}
+		for _, wID := range m.sortedNeighs(vID) {
+			if _, ok := in[wID]; ok {
+				res = append(res, [3]int64{vID, wID, m.rels[vID][wID]})
+			}
+		}
+		in[vID] = false
+	}
+	return res
+}
+
+// RandomArticles will return a specified amount of
+// randomly picked articles.
+func (m *MemGraphManager) RandomArticles(
+	ctx context.Context, amount int) ([]*db.WikiData, error,
+) {
+	return m.SampleArticles(ctx, db.SampleOptions{Amount: amount})
+}
+
+// SampleArticles returns up to <opts.Amount> randomly picked
+// articles, see db.SampleOptions for the filters.
+func (m *MemGraphManager) SampleArticles(
+	ctx context.Context, opts db.SampleOptions) ([]*db.WikiData, error,
+) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	candidates := m.order
+	if opts.NeighOf != nil {
+		candidates = m.sortedNeighs(*opts.NeighOf)
+	}
+	if opts.MinInDegree > 0 {
+		in := make(map[int64]int, len(candidates))
+		for _, to := range m.rels {
+			for wID := range to {
+				in[wID]++
+			}
+		}
+		filtered := make([]int64, 0, len(candidates))
+		for _, id := range candidates {
+			if in[id] >= opts.MinInDegree {
+				filtered = append(filtered, id)
+			}
+		}
+		candidates = filtered
+	}
+
+	var ids []int64
+	if opts.Seed != nil {
+		ids = db.SampleIDs(candidates, opts.Amount, opts.Rand())
+	} else {
+		ids = m.randSample(candidates, opts.Amount)
+	}
+	res := make([]*db.WikiData, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, m.articles[id].wikiData())
+	}
+	return res, nil
+}
+
+// FillArticleFields sets the optional <fields> of all <data> in
+// place, see db.StoredWikiManager. Degrees & lookups are counted
+// in a single pass over all links.
+func (m *MemGraphManager) FillArticleFields(
+	ctx context.Context, data []*db.WikiData, fields []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	// # In-degree & lookups need incoming links, which
+	// # aren't indexed, so they're counted for all data.
+	in, lookups := make(map[int64]int64), make(map[int64]int64)
+	if db.HasField(fields, db.FieldInDegree) || db.HasField(fields, db.FieldLookups) {
+		for _, d := range data {
+			in[d.ID], lookups[d.ID] = 0, 0
+		}
+		for _, to := range m.rels {
+			for wID, l := range to {
+				if _, ok := in[wID]; ok {
+					in[wID]++
+					lookups[wID] += l
+				}
+			}
+		}
+	}
+	for _, d := range data {
+		a := m.articles[d.ID]
+		if a == nil {
+			continue
+		}
+		for _, f := range fields {
+			switch f {
+			case db.FieldSummary:
+				d.Summary = a.summary
+			case db.FieldOutDegree:
+				out := int64(len(m.rels[a.id]))
+				d.OutDegree = &out
+			case db.FieldInDegree:
+				x := in[a.id]
+				d.InDegree = &x
+			case db.FieldLookups:
+				x := lookups[a.id]
+				d.Lookups = &x
+			case db.FieldCategories:
+				d.Categories = a.categories
+			case db.FieldUpdated:
+				updated := a.updated
+				d.Updated = &updated
+			}
+		}
+	}
+	return nil
+}
+
+// IncrementRel increments the 'lookups' of the HYPERLINKS relationship
+// between two articles with the given IDs. Nothing happens if there
+// is no such relationship (same as the Cypher MATCH in pkg neo4j).
+func (m *MemGraphManager) IncrementRel(
+	ctx context.Context, vID, wID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if lookups, ok := m.rels[vID][wID]; ok {
+		m.rels[vID][wID] = lookups + 1
+	}
+	return nil
+}
+
+// weightedPick orders the articles in <candidates> (id -> lookups)
+// randomly, weighted by lookups, and returns at most <limit> of them.
+// This is the equivalent of the 'lookups * rand()' ordering done in
+// Cypher by pkg neo4j. Expects m.mx to be held.
+func (m *MemGraphManager) weightedPick(candidates map[int64]int64, limit int,
+) []*db.WikiData {
+	type pick struct {
+		a   *article
+		ord float64
+	}
+	picks := make([]pick, 0, len(candidates))
+	for id, lookups := range candidates {
+		// # Same as the Cypher; missing lookups count as 1.
+		if lookups < 1 {
+			lookups = 1
+		}
+		picks = append(picks, pick{
+			a: m.articles[id], ord: float64(lookups) * m.randFloat64()})
+	}
+	sort.Slice(picks, func(i, j int) bool {
+		return picks[i].ord > picks[j].ord
+	})
+
+	res := make([]*db.WikiData, 0, clamp(limit, len(picks)))
+	for i := 0; i < len(picks) && i < limit; i++ {
+		res = append(res, picks[i].a.wikiData())
+	}
+	return res
+}
+
+// sortedNeighs returns the ids of the articles linked from the
+// article with <id>, sorted so traversals are deterministic.
+// Expects m.mx to be held.
+func (m *MemGraphManager) sortedNeighs(id int64) []int64 {
+	res := make([]int64, 0, len(m.rels[id]))
+	for wID := range m.rels[id] {
+		res = append(res, wID)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// window returns the part of <ids> after skipping the first
+// <offset> elements, with at most <limit> elements.
+func window(ids []int64, offset, limit int) []int64 {
+	ids = ids[clamp(offset, len(ids)):]
+	return ids[:clamp(limit, len(ids))]
+}
+
+// clamp returns n limited to [0, max]; used for slice capacities.
+func clamp(n, max int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,159 @@
+package neo4j
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+	"wikinodes-server/db"
+)
+
+// This file contains schema & data migrations, which are not
+// part of the db interfaces but are run by subcommands.
+
+// EnsureSchema creates the uniqueness constraint of stable ids
+// (the 'pageid' property) and the index of legacy ids, unless
+// they already exist. This needs Neo4j 4.1 or later.
+func (n *Neo4jManager) EnsureSchema(ctx context.Context) error {
+	// # Schema changes can't share a tx with anything else.
+	for _, cql := range []string{`
+		CREATE CONSTRAINT WikiDataPageID IF NOT EXISTS
+		    ON (v:WikiData) ASSERT v.pageid IS UNIQUE
+	`, `
+		CREATE INDEX WikiDataLegacyID IF NOT EXISTS
+		   FOR (v:WikiData) ON (v.legacyid)
+	`} {
+		if err := n.execute(ctx, executeParams{cypher: cql, write: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateStats tells what MigrateIDs did. Articles that couldn't
+// be migrated are listed by their internal id() (which is what
+// their legacy id would have been).
+type MigrateStats struct {
+	Migrated int
+	// Articles without a title, which a stable id is made from.
+	Untitled []int64
+	// Articles whose stable id is already taken, by another
+	// article or an earlier one in the same run with the same title.
+	Collisions []int64
+}
+
+// Skipped is the amount of articles that couldn't be migrated.
+func (s *MigrateStats) Skipped() int {
+	return len(s.Untitled) + len(s.Collisions)
+}
+
+// MigrateIDs gives a stable id (see db.StableID) to all articles
+// that don't have one, i.e ones added before stable ids existed.
+// Their internal id() is kept as legacy id, so old links can be
+// resolved with SearchArticlesByLegacyID. Articles are migrated
+// <batch> at a time. Articles without a title or whose stable id
+// is taken are skipped and listed in the returned stats, and an
+// error is returned if any article is left without a stable id
+// in the end. It's safe to run again, e.g after being interrupted.
+func (n *Neo4jManager) MigrateIDs(ctx context.Context, batch int,
+) (MigrateStats, error) {
+	stats := MigrateStats{}
+	// # Stable ids given in this run, as duplicate titles within
+	// # a batch aren't seen by the collision check of the query.
+	given := make(map[int64]bool)
+	// # Paged by id(), so that skipped articles aren't read again.
+	after := int64(-1)
+	for {
+		rows := make([]interface{}, 0, batch)
+		read := 0
+		cql := `
+			MATCH (v:WikiData)
+			WHERE v.pageid IS NULL AND id(v) > $after
+		   RETURN id(v) as i, v.title as t
+		 ORDER BY i
+			LIMIT $batch
+		`
+		err := n.execute(ctx, executeParams{
+			cypher:   cql,
+			bindings: map[string]interface{}{"after": after, "batch": batch},
+			callback: func(r neo4j.Result) {
+				read++
+				legacy, _ := n.unpackInt64(r, "i")
+				after = legacy
+				title, ok := n.unpackString(r, "t")
+				if !ok {
+					stats.Untitled = append(stats.Untitled, legacy)
+					return
+				}
+				id := db.StableID(title)
+				if given[id] {
+					stats.Collisions = append(stats.Collisions, legacy)
+					return
+				}
+				given[id] = true
+				rows = append(rows, map[string]interface{}{
+					"legacy": legacy, "id": id})
+			},
+		})
+		if err != nil {
+			return stats, err
+		}
+		if read == 0 {
+			break
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		// # Articles whose id is taken by another one are left as is.
+		cql = `
+			UNWIND $rows AS r
+			 MATCH (v:WikiData)
+			 WHERE id(v) = r.legacy
+			OPTIONAL MATCH (o:WikiData)
+			 WHERE o.pageid = r.id
+			  WITH v, r, count(o) = 0 as free
+			FOREACH (_ IN CASE WHEN free THEN [1] ELSE [] END |
+			   SET v.pageid = r.id, v.legacyid = r.legacy)
+		   RETURN r.legacy as l, free as f
+		`
+		err = n.execute(ctx, executeParams{
+			cypher:   cql,
+			bindings: map[string]interface{}{"rows": rows},
+			write:    true,
+			callback: func(r neo4j.Result) {
+				if free, _ := n.unpackBool(r, "f"); free {
+					stats.Migrated++
+					return
+				}
+				legacy, _ := n.unpackInt64(r, "l")
+				stats.Collisions = append(stats.Collisions, legacy)
+			},
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	// # Also catches articles added while migrating.
+	remaining := int64(0)
+	err := n.execute(ctx, executeParams{
+		cypher: `
+			MATCH (v:WikiData)
+			WHERE v.pageid IS NULL
+		   RETURN count(v) as c
+		`,
+		callback: func(r neo4j.Result) {
+			remaining, _ = n.unpackInt64(r, "c")
+		},
+	})
+	if err != nil {
+		return stats, err
+	}
+	if remaining > 0 {
+		return stats, fmt.Errorf(
+			"%d articles left without a stable id (%d untitled, %d collisions)",
+			remaining, len(stats.Untitled), len(stats.Collisions))
+	}
+	return stats, nil
+}
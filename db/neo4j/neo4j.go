@@ -1,7 +1,11 @@
 package neo4j
 
 import (
-	"sync"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"wikinodes-server/config"
 	"wikinodes-server/db"
 
 	"github.com/neo4j/neo4j-go-driver/neo4j"
@@ -13,32 +17,45 @@ type executeParams struct {
 	cypher   string
 	bindings map[string]interface{}
 	callback func(neo4j.Result)
+	// # Queries are reads unless this is set, see execute.
+	write bool
 }
 
-// Neo4jManager implements db.StoredWikiManager.
+// Returned by execute when a transaction fails after records were
+// handed to the callback, since retrying would hand them over twice.
+var errPartialResult = errors.New("neo4j transaction failed mid-result")
+
+// Neo4jManager implements db.StoredWikiManager,
+// db.StoredWikiWriter & db.StoredWikiIterator.
 // But seriously, why can't this be done like the
 // Rust folks do it, ya know, like sane people?!
 //
 // 			i m p l i c i t 		\(︶︹ ︺')/
 //
 var _ db.StoredWikiManager = &Neo4jManager{}
+var _ db.StoredWikiWriter = &Neo4jManager{}
+var _ db.StoredWikiIterator = &Neo4jManager{}
 
 // Neo4jManager -- manages neo4j connection and friends.
+// It's safe for concurrent use, queries share the driver's
+// connection pool.
 type Neo4jManager struct {
-	mx sync.Mutex
 	db neo4j.Driver
 }
 
 // New attempts to return Neo4jManager with an active
-// Neo4j driver.
-func New(uri, usr, pwd string) (*Neo4jManager, error) {
+// Neo4j driver, configured by <conf>.
+func New(conf config.Neo4j) (*Neo4jManager, error) {
 	new := Neo4jManager{}
 
 	driver, err := neo4j.NewDriver(
-		uri,
-		neo4j.BasicAuth(usr, pwd, ""),
+		conf.URI,
+		neo4j.BasicAuth(conf.USR, conf.PWD, ""),
 		func(c *neo4j.Config) {
 			c.Encrypted = false
+			c.MaxConnectionPoolSize = conf.MaxPoolSize
+			c.ConnectionAcquisitionTimeout = conf.PoolAcquisitionTimeout
+			c.MaxTransactionRetryTime = conf.MaxRetryTime
 		},
 	)
 	if err != nil {
@@ -49,31 +66,96 @@ func New(uri, usr, pwd string) (*Neo4jManager, error) {
 	return &new, nil
 }
 
-// General async-safe executor, expects T executeParams
-// as arg, see type def in this pkg.
-func (n *Neo4jManager) execute(x executeParams) error {
-	// # Standard syncing.
-	n.mx.Lock()
-	defer n.mx.Unlock()
+// Close closes the Neo4j driver, along with its connection pool.
+// Queries still running will fail, so the server should be done
+// with requests first.
+func (n *Neo4jManager) Close() error {
+	// # New might have failed before setting the driver.
+	if n.db == nil {
+		return nil
+	}
+	return n.db.Close()
+}
 
-	// # Open.
-	session, err := n.db.Session(neo4j.AccessModeWrite)
-	if err != nil {
+// General async-safe executor, expects T executeParams
+// as arg, see type def in this pkg. Reads are run in read
+// transactions (which can be routed to followers in a
+// cluster), writes in write transactions. Both are retried
+// on transient errors, for up to the configured retry time,
+// but only until the first record has been handed to the
+// callback. Gives up once <ctx> is done, be it before starting
+// or between records. If <ctx> has a deadline, then the query
+// is run with a matching timeout, so Neo4j terminates it as well.
+func (n *Neo4jManager) execute(ctx context.Context, x executeParams) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	defer session.Close()
 
-	// # Execute.
-	res, err := session.Run(x.cypher, x.bindings)
+	// # Timeout, if any.
+	configurers := make([]func(*neo4j.TransactionConfig), 0, 1)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		configurers = append(configurers, neo4j.WithTxTimeout(timeout))
+	}
+
+	// # Open.
+	mode := neo4j.AccessModeRead
+	if x.write {
+		mode = neo4j.AccessModeWrite
+	}
+	session, err := n.db.Session(mode)
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
+	defer session.Close()
 
-	// # Optional callback.
-	if x.callback != nil {
+	// # Execute, possibly more than once.
+	delivered := false
+	var failure error
+	work := func(tx neo4j.Transaction) (interface{}, error) {
+		// # Records can't be taken back from the callback,
+		// # so retrying after some were handed over is a no-go.
+		if delivered && failure != nil {
+			return nil, fmt.Errorf("%w: %v", errPartialResult, failure)
+		}
+		if delivered {
+			return nil, errPartialResult
+		}
+		res, err := tx.Run(x.cypher, x.bindings)
+		if err != nil {
+			return nil, err
+		}
+		// # Optional callback.
+		if x.callback == nil {
+			_, err = res.Consume()
+			return nil, err
+		}
 		for res.Next() {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			delivered = true
 			x.callback(res)
 		}
+		// # Such as the timeout above being hit.
+		failure = res.Err()
+		return nil, failure
+	}
+	if x.write {
+		_, err = session.WriteTransaction(work, configurers...)
+	} else {
+		_, err = session.ReadTransaction(work, configurers...)
+	}
+	return wrapErr(err)
+}
+
+// wrapErr wraps connectivity errors in db.ErrUnavailable.
+func wrapErr(err error) error {
+	if neo4j.IsServiceUnavailable(err) || neo4j.IsSessionExpired(err) {
+		return fmt.Errorf("%w: %v", db.ErrUnavailable, err)
 	}
-	return nil
+	return err
 }
@@ -1,8 +1,15 @@
 package neo4j
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"strings"
 	"testing"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
 )
 
 var (
@@ -12,6 +19,8 @@ var (
 	pwd = ""
 	// Global db manager.
 	n *Neo4jManager = nil
+	// Context for all queries.
+	ctx = context.Background()
 )
 
 func init() {
@@ -21,7 +30,9 @@ func init() {
 	}
 
 	// # Try set global db manager
-	m, err := New(uri, usr, pwd)
+	conf := config.Default().Neo4j
+	conf.URI, conf.USR, conf.PWD = uri, usr, pwd
+	m, err := New(conf)
 	if err != nil {
 		msg := fmt.Sprintf("db connection err: %v", err)
 		panic(msg)
@@ -32,26 +43,32 @@ func init() {
 
 // ------------ a few methods for creating data --------------- //
 func (n *Neo4jManager) clear() error {
-	return n.execute(executeParams{
+	return n.execute(ctx, executeParams{
 		cypher: "MATCH (n:WikiData) DETACH DELETE n",
+		write:  true,
 	})
 }
 
 func (n *Neo4jManager) createNode(title, content, html string) error {
-	return n.execute(executeParams{
-		cypher: "CREATE (:WikiData {title:$title, html:$html, content:$content})",
+	return n.execute(ctx, executeParams{
+		cypher: "CREATE (:WikiData {pageid:$id, title:$title, html:$html, content:$content})",
 		bindings: map[string]interface{}{
-			"title": title, "html": html, "content": content},
+			"id": db.StableID(title), "title": title, "html": html, "content": content},
 		callback: nil,
+		write:    true,
 	})
 }
 
 func (n *Neo4jManager) createNodesAndRel(vTitle, wTitle string) error {
-	cql := "MERGE (:WikiData{title:$vTitle})-[:HYPERLINKS]->(:WikiData{title:$wTitle})"
-	return n.execute(executeParams{
-		cypher:   cql,
-		bindings: map[string]interface{}{"vTitle": vTitle, "wTitle": wTitle},
+	cql := `MERGE (:WikiData{pageid:$vID, title:$vTitle})
+		   -[:HYPERLINKS]->(:WikiData{pageid:$wID, title:$wTitle})`
+	return n.execute(ctx, executeParams{
+		cypher: cql,
+		bindings: map[string]interface{}{
+			"vID": db.StableID(vTitle), "vTitle": vTitle,
+			"wID": db.StableID(wTitle), "wTitle": wTitle},
 		callback: nil,
+		write:    true,
 	})
 }
 
@@ -62,7 +79,7 @@ func TestSearchArticlesByTitle(t *testing.T) {
 	defer n.clear()
 	title, content, html := "a", "", ""
 	n.createNode(title, content, html)
-	data, err := n.SearchArticlesByTitle(title)
+	data, err := n.SearchArticlesByTitle(ctx, title, 0, 10)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -81,14 +98,27 @@ func TestSearchArticlesByContent(t *testing.T) {
 	title, content, html := "a", "b", "c"
 	n.createNode(title, content, html)
 
-	res, err := n.SearchArticlesByContent(content, 1)
+	res, err := n.SearchArticlesByContent(ctx, content, 0, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if res[0].Title != title {
 		t.Fatal("got incorrect result")
 	}
+	if res[0].Score <= 0 || res[0].Snippet != "<mark>b</mark>" {
+		t.Fatalf("unexpected score/snippet: %v, %v", res[0].Score, res[0].Snippet)
+	}
 
+	// # Long content is cut around the match, in the db.
+	long := strings.Repeat("x ", 5000) + "needle" + strings.Repeat(" y", 5000)
+	n.createNode("long", long, "")
+	res, err = n.SearchArticlesByContent(ctx, "needle", 0, 1)
+	if err != nil || len(res) != 1 {
+		t.Fatalf("unexpected result: %v, %v", err, res)
+	}
+	if want := db.Snippet(long, "needle", db.SnippetWidth); res[0].Snippet != want {
+		t.Fatalf("wanted snippet:\n%v\ngot:\n%v", want, res[0].Snippet)
+	}
 }
 
 func TestSearchArticlesByID(t *testing.T) {
@@ -99,12 +129,12 @@ func TestSearchArticlesByID(t *testing.T) {
 
 	// # Get and check unsafely for brevity. The
 	// # previous test checks this properly.
-	data, _ := n.SearchArticlesByTitle(title)
+	data, _ := n.SearchArticlesByTitle(ctx, title, 0, 10)
 	if data[0].Title != title {
 		t.Fatal("unexpected title result: ", data[0].Title)
 	}
 
-	res, _ := n.SearchArticlesByID(data[0].ID)
+	res, _ := n.SearchArticlesByID(ctx, data[0].ID)
 	if data[0].Title != res[0].Title {
 		t.Fatal("unexpected id result")
 	}
@@ -116,8 +146,8 @@ func TestSearchArticlesNeighsByID(t *testing.T) {
 	vTitle, wTitle := "v", "w"
 	n.createNodesAndRel(vTitle, wTitle)
 
-	data, _ := n.SearchArticlesByTitle(vTitle)
-	res, _ := n.SearchArticlesNeighsByID(data[0].ID, 1)
+	data, _ := n.SearchArticlesByTitle(ctx, vTitle, 0, 10)
+	res, _ := n.SearchArticlesNeighsByID(ctx, data[0].ID, 1)
 	t.Log("Got here")
 	if res[0].Title != wTitle {
 		t.Fatal("did not get neighbour")
@@ -131,8 +161,8 @@ func TestSearchArticlesHTMLByID(t *testing.T) {
 	title, content, html := "v", "", "some content"
 	n.createNode(title, content, html)
 
-	data, _ := n.SearchArticlesByTitle(title)
-	res, _ := n.SearchArticlesHTMLByID(data[0].ID)
+	data, _ := n.SearchArticlesByTitle(ctx, title, 0, 10)
+	res, _ := n.SearchArticlesHTMLByID(ctx, data[0].ID)
 	if res != html {
 		t.Fatal("expected html, got: " + res)
 	}
@@ -147,10 +177,10 @@ func TestCheckRelsExistByIDs(t *testing.T) {
 	n.createNode(wTitle, "", "")
 
 	// # This section should fail since there are no rels.
-	vData, _ := n.SearchArticlesByTitle(vTitle)
-	wData, _ := n.SearchArticlesByTitle(wTitle)
+	vData, _ := n.SearchArticlesByTitle(ctx, vTitle, 0, 10)
+	wData, _ := n.SearchArticlesByTitle(ctx, wTitle, 0, 10)
 
-	r1, _ := n.CheckRelsExistByIDs([][2]int64{{vData[0].ID, wData[0].ID}})
+	r1, _ := n.CheckRelsExistByIDs(ctx, [][2]int64{{vData[0].ID, wData[0].ID}})
 	if r1[0] == true {
 		t.Fatal("rel check should be false")
 	}
@@ -158,10 +188,10 @@ func TestCheckRelsExistByIDs(t *testing.T) {
 
 	// # This section should _not_ fail since there are rels.
 	n.createNodesAndRel(vTitle, wTitle)
-	vData, _ = n.SearchArticlesByTitle(vTitle)
-	wData, _ = n.SearchArticlesByTitle(wTitle)
+	vData, _ = n.SearchArticlesByTitle(ctx, vTitle, 0, 10)
+	wData, _ = n.SearchArticlesByTitle(ctx, wTitle, 0, 10)
 
-	r2, _ := n.CheckRelsExistByIDs([][2]int64{{vData[0].ID, wData[0].ID}})
+	r2, _ := n.CheckRelsExistByIDs(ctx, [][2]int64{{vData[0].ID, wData[0].ID}})
 	if r2[0] == false {
 		t.Fatal("rel check should be true")
 	}
@@ -184,7 +214,7 @@ func TestRandomArticles(t *testing.T) {
 	// # Check for thrice in a row, should be unlikely
 	matches := 0
 	for i := 0; i < 3; i++ {
-		res, _ := n.RandomArticles(1)
+		res, _ := n.RandomArticles(ctx, 1)
 		if res[0].Title == titles[5] { // # 5 is arbitrary.
 			matches += 1
 		}
@@ -194,32 +224,82 @@ func TestRandomArticles(t *testing.T) {
 	}
 }
 
+func TestSampleArticles(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	// # rel: hub -> 0..9, and 0..9 -> well
+	for i := 0; i < 10; i++ {
+		leaf := fmt.Sprintf("%v", i)
+		n.createNodesAndRel("hub", leaf)
+		n.createNodesAndRel(leaf, "well")
+	}
+	hub := db.StableID("hub")
+
+	// # Same seed, same sample, in the same order.
+	seed := int64(42)
+	a, err := n.SampleArticles(ctx, db.SampleOptions{Amount: 5, Seed: &seed})
+	b, _ := n.SampleArticles(ctx, db.SampleOptions{Amount: 5, Seed: &seed})
+	if err != nil || len(a) != 5 || len(b) != 5 {
+		t.Fatalf("unexpected sample: %v, %v", err, a)
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			t.Fatalf("expected the same sample: %v, %v", a, b)
+		}
+	}
+	// # Tiny graph, so all articles come from the fallback.
+	res, _ := n.SampleArticles(ctx, db.SampleOptions{Amount: 100})
+	if len(res) != 12 {
+		t.Fatal("expected all articles, got: ", len(res))
+	}
+	res, _ = n.SampleArticles(ctx, db.SampleOptions{Amount: 100, NeighOf: &hub})
+	if len(res) != 10 {
+		t.Fatal("expected all neighbours, got: ", len(res))
+	}
+	res, _ = n.SampleArticles(ctx, db.SampleOptions{Amount: 3, MinInDegree: 2})
+	if len(res) != 1 || res[0].Title != "well" {
+		t.Fatalf("expected the well-linked article, got: %v", res)
+	}
+}
+
+func TestRandInRange(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, r := range [][2]int64{
+		{math.MinInt64, math.MaxInt64}, {-5, math.MaxInt64}, {-3, 3}, {7, 7}} {
+		for i := 0; i < 1000; i++ {
+			if x := randInRange(rng, r[0], r[1]); x < r[0] || x > r[1] {
+				t.Fatalf("%d not in %v", x, r)
+			}
+		}
+	}
+}
+
 func TestIncrementRelAndSearchArticlesNeighsByID(t *testing.T) {
 	n.clear()
 	defer n.clear()
 	// # rel: q -> a,b,c
-	n.execute(executeParams{cypher: `
+	n.execute(ctx, executeParams{cypher: `
 		CREATE (q:WikiData{title:'q'})-[:HYPERLINKS]
 								->(:WikiData{title:'a'})
 		CREATE (q)-[:HYPERLINKS]->(:WikiData{title:'b'})
 		CREATE (q)-[:HYPERLINKS]->(:WikiData{title:'c'})
-	`})
+	`, write: true})
 	// # Get ID for all new nodes.
 	titles := []string{"q", "a", "b", "c"}
 	ids := make([]int64, 4)
 	for i, v := range titles {
-		r, _ := n.SearchArticlesByTitle(v)
+		r, _ := n.SearchArticlesByTitle(ctx, v, 0, 10)
 		ids[i] = (*r[0]).ID
 	}
 	// # Incr rels such that best-fit should be in order: a,b,c
 	for i := 0; i < 200; i++ {
-		n.IncrementRel(ids[0], ids[1])
+		n.IncrementRel(ctx, ids[0], ids[1])
 	}
 	for i := 0; i < 100; i++ {
-		n.IncrementRel(ids[0], ids[2])
+		n.IncrementRel(ctx, ids[0], ids[2])
 	}
 	// # Get & check data.
-	res, _ := n.SearchArticlesNeighsByID(ids[0], 3)
+	res, _ := n.SearchArticlesNeighsByID(ctx, ids[0], 3)
 	resTitles := make([]string, 0, 4)
 	for _, v := range res {
 		resTitles = append(resTitles, (*v).Title)
@@ -230,3 +310,214 @@ func TestIncrementRelAndSearchArticlesNeighsByID(t *testing.T) {
 			titles[1:], resTitles)
 	}
 }
+
+func TestSearchArticlesPathByIDs(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	// # rel: a -> b -> c, a -> c
+	n.execute(ctx, executeParams{cypher: `
+		CREATE (a:WikiData{title:'a'})-[:HYPERLINKS]
+								->(b:WikiData{title:'b'})
+		CREATE (b)-[:HYPERLINKS]->(c:WikiData{title:'c'})
+		CREATE (a)-[:HYPERLINKS]->(c)
+	`, write: true})
+	aData, _ := n.SearchArticlesByTitle(ctx, "a", 0, 10)
+	cData, _ := n.SearchArticlesByTitle(ctx, "c", 0, 10)
+
+	res, err := n.SearchArticlesPathByIDs(ctx, aData[0].ID, cData[0].ID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].Title != "a" || res[1].Title != "c" {
+		t.Fatalf("unexpected path: %v", res)
+	}
+	// # Order matters.
+	res, _ = n.SearchArticlesPathByIDs(ctx, cData[0].ID, aData[0].ID, 3)
+	if len(res) != 0 {
+		t.Fatalf("expected no path, got: %v", res)
+	}
+}
+
+func TestSearchSubgraphByID(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	// # rel: a -> b -> c -> a
+	n.execute(ctx, executeParams{cypher: `
+		CREATE (a:WikiData{title:'a'})-[:HYPERLINKS]
+								->(b:WikiData{title:'b'})
+		CREATE (b)-[:HYPERLINKS]->(c:WikiData{title:'c'})
+		CREATE (c)-[:HYPERLINKS]->(a)
+	`, write: true})
+	aData, _ := n.SearchArticlesByTitle(ctx, "a", 0, 10)
+
+	res, err := n.SearchSubgraphByID(ctx, aData[0].ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Nodes) != 2 || len(res.Edges) != 1 {
+		t.Fatalf("unexpected depth 1 subgraph: %v, %v", res.Nodes, res.Edges)
+	}
+	res, _ = n.SearchSubgraphByID(ctx, aData[0].ID, 2, 10)
+	if len(res.Nodes) != 3 || len(res.Edges) != 3 {
+		t.Fatalf("unexpected depth 2 subgraph: %v, %v", res.Nodes, res.Edges)
+	}
+}
+
+func TestSearchArticlesBacklinksByID(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	vTitle, wTitle := "v", "w"
+	n.createNodesAndRel(vTitle, wTitle)
+
+	data, _ := n.SearchArticlesByTitle(ctx, wTitle, 0, 10)
+	res, _ := n.SearchArticlesBacklinksByID(ctx, data[0].ID, 1)
+	if len(res) == 0 || res[0].Title != vTitle {
+		t.Fatal("did not get backlink")
+	}
+}
+
+func TestSearchArticlesByTitleFuzzy(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	n.createNode("Last Thursdayism", "", "")
+	n.createNode("Lasagna", "", "")
+
+	res, err := n.SearchArticlesByTitleFuzzy(ctx, "last thursdya", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Title != "Last Thursdayism" {
+		t.Fatalf("unexpected result: %v", res)
+	}
+}
+
+func TestFillArticleFields(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	err := n.AddArticles(ctx, []*db.WikiArticle{
+		{Title: "v", Content: "Lead of v.\nMore.", Categories: []string{"x"}},
+		{Title: "w"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.AddRels(ctx, []*db.WikiRel{{From: "v", To: "w", Lookups: 3}})
+
+	data := []*db.WikiData{{ID: db.StableID("v")}, {ID: db.StableID("w")}}
+	if err := n.FillArticleFields(ctx, data, db.Fields); err != nil {
+		t.Fatal(err)
+	}
+	v, w := data[0], data[1]
+	if v.Summary != "Lead of v." || *v.OutDegree != 1 || len(v.Categories) != 1 ||
+		v.Updated == nil {
+		t.Fatalf("unexpected v: %+v", v)
+	}
+	if *w.InDegree != 1 || *w.Lookups != 3 {
+		t.Fatalf("unexpected w: %+v", w)
+	}
+}
+
+func TestLookupArticles(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	n.createNode("v", "", "")
+	n.createNode("w", "", "")
+	v, w := db.StableID("v"), db.StableID("w")
+
+	res, err := n.LookupArticles(ctx, []int64{v, 12345}, []string{"w", "nope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ByID) != 1 || res.ByID[v].Title != "v" ||
+		len(res.ByTitle) != 1 || res.ByTitle["w"].ID != w {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if len(res.MissingIDs) != 1 || len(res.MissingTitles) != 1 {
+		t.Fatalf("unexpected missing: %v, %v", res.MissingIDs, res.MissingTitles)
+	}
+}
+
+func TestCheckRelsByIDs(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	n.createNodesAndRel("v", "w")
+	v, w := db.StableID("v"), db.StableID("w")
+	n.IncrementRel(ctx, v, w)
+
+	res, err := n.CheckRelsByIDs(ctx, [][2]int64{{v, w}, {w, v}, {v, w}})
+	if err != nil || len(res) != 3 {
+		t.Fatalf("unexpected result: %v, %v", err, res)
+	}
+	if !res[0].Exists || res[0].Lookups != 1 || res[1].Exists || !res[2].Exists {
+		t.Fatalf("unexpected checks: %+v", res)
+	}
+
+	edges, err := n.SearchRelsAmongIDs(ctx, []int64{v, w})
+	if err != nil || len(edges) != 1 || edges[0] != [3]int64{v, w, 1} {
+		t.Fatalf("unexpected edges: %v, %v", err, edges)
+	}
+}
+
+func TestEachArticleStops(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	for i := 0; i < 3; i++ {
+		n.createNodesAndRel(fmt.Sprint("v", i), fmt.Sprint("w", i))
+	}
+	stop := errors.New("stop")
+
+	calls := 0
+	err := n.EachArticle(ctx, false, func(*db.WikiArticle) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("unexpected stop: %v, %d calls", err, calls)
+	}
+	calls = 0
+	err = n.EachRel(ctx, func(r *db.WikiRel) error {
+		calls++
+		if r.FromID != db.StableID(r.From) || r.ToID != db.StableID(r.To) {
+			t.Fatalf("unexpected rel: %+v", r)
+		}
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("unexpected stop: %v, %d calls", err, calls)
+	}
+}
+
+func TestMigrateIDs(t *testing.T) {
+	n.clear()
+	defer n.clear()
+	// # Taken by an article that already has a stable id.
+	n.createNode("taken", "", "")
+	err := n.execute(ctx, executeParams{
+		cypher: `
+			CREATE (:WikiData {title:"a"}), (:WikiData {title:"a"}),
+			       (:WikiData {title:"b"}), (:WikiData {title:"taken"}),
+			       (:WikiData {content:"untitled"})
+		`,
+		write: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// # Batches of 1, so that collisions span batches too.
+	stats, err := n.MigrateIDs(ctx, 1)
+	if err == nil || stats.Migrated != 2 || len(stats.Untitled) != 1 ||
+		len(stats.Collisions) != 2 || stats.Skipped() != 3 {
+		t.Fatalf("unexpected migration: %v, %+v", err, stats)
+	}
+	res, err := n.SearchArticlesByID(ctx, db.StableID("b"))
+	if err != nil || len(res) != 1 || res[0].Title != "b" {
+		t.Fatalf("unexpected b: %v, %v", err, res)
+	}
+
+	// # Running again migrates nothing new, skipped ones remain.
+	stats, err = n.MigrateIDs(ctx, 10)
+	if err == nil || stats.Migrated != 0 || stats.Skipped() != 3 {
+		t.Fatalf("unexpected rerun: %v, %+v", err, stats)
+	}
+}
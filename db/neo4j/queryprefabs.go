@@ -1,6 +1,10 @@
 package neo4j
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/neo4j/neo4j-go-driver/neo4j"
 	"wikinodes-server/db"
 )
@@ -8,13 +12,18 @@ import (
 // This file contains exported funcs (the API)
 // of this pkg -- they communicate with the db.
 // The purpose is to satisfy the db.DBManager
-// behaviour in db/protocols.go.
+// behaviour in db/protocols.go. All of them
+// give up once their ctx is done, see execute.
 //
 //
 //
 
 // ---------------- utils ------------------ //
 
+// How many candidates SearchArticlesByTitleFuzzy fetches
+// per wanted result, before ranking them.
+const titleFuzzyCandidates = 10
+
 // simple 'contains' func, because yay go!
 func contains(s string, others []string) bool {
 	for i := 0; i < len(others); i++ {
@@ -31,15 +40,16 @@ func contains(s string, others []string) bool {
 
 // SearchArticlesByID will search through articles
 // by their IDs and return all matches.
-func (n *Neo4jManager) SearchArticlesByID(id int64) ([]*db.WikiData, error,
+func (n *Neo4jManager) SearchArticlesByID(
+	ctx context.Context, id int64) ([]*db.WikiData, error,
 ) {
 	res := make([]*db.WikiData, 0, 1) // # 1 is logically expected.
 	cql := `
 		MATCH (v:WikiData)
-		WHERE id(v) = $id
-		RETURN id(v) as i, v.title as t 
+		WHERE v.pageid = $id
+		RETURN v.pageid as i, v.title as t 
 	`
-	err := n.execute(executeParams{
+	err := n.execute(ctx, executeParams{
 		cypher:   cql,
 		bindings: map[string]interface{}{"id": id},
 		callback: func(r neo4j.Result) {
@@ -52,17 +62,22 @@ func (n *Neo4jManager) SearchArticlesByID(id int64) ([]*db.WikiData, error,
 	return res, err
 }
 
-// SearchArticlesByTitle will search through articles
-// by their title and return all matches.
-func (n *Neo4jManager) SearchArticlesByTitle(title string) ([]*db.WikiData, error,
+// SearchArticlesByLegacyID will search through articles by
+// the ids they had before stable ids (see MigrateIDs), for
+// resolving old links. This is fast with the index made by
+// EnsureSchema.
+func (n *Neo4jManager) SearchArticlesByLegacyID(
+	ctx context.Context, legacyID int64) ([]*db.WikiData, error,
 ) {
-	res := make([]*db.WikiData, 0, 5) // # 5 is arbitrary.
+	res := make([]*db.WikiData, 0, 1) // # 1 is logically expected.
 	cql := `
-		MATCH (v:WikiData {title:$title}) RETURN id(v) as i, v.title as t 
+		MATCH (v:WikiData)
+		WHERE v.legacyid = $id
+		RETURN v.pageid as i, v.title as t
 	`
-	err := n.execute(executeParams{
+	err := n.execute(ctx, executeParams{
 		cypher:   cql,
-		bindings: map[string]interface{}{"title": title},
+		bindings: map[string]interface{}{"id": legacyID},
 		callback: func(r neo4j.Result) {
 			v, ok := n.unpackWikiData(r, "i", "t")
 			if ok {
@@ -73,27 +88,155 @@ func (n *Neo4jManager) SearchArticlesByTitle(title string) ([]*db.WikiData, erro
 	return res, err
 }
 
+// LookupArticles looks up articles by <ids> and <titles> in a
+// single query (rather than one per article), see db.WikiLookup.
+// Lookups by title are fast with an index on titles.
+func (n *Neo4jManager) LookupArticles(
+	ctx context.Context, ids []int64, titles []string) (*db.WikiLookup, error,
+) {
+	found := make([]*db.WikiData, 0, len(ids)+len(titles))
+	if ids == nil {
+		ids = []int64{}
+	}
+	if titles == nil {
+		titles = []string{}
+	}
+	cql := `
+		UNWIND $ids AS id
+		 MATCH (v:WikiData {pageid: id})
+		RETURN v.pageid as i, v.title as t
+		 UNION ALL
+		UNWIND $titles AS title
+		 MATCH (v:WikiData {title: title})
+		RETURN v.pageid as i, v.title as t
+	`
+	err := n.execute(ctx, executeParams{
+		cypher:   cql,
+		bindings: map[string]interface{}{"ids": ids, "titles": titles},
+		callback: func(r neo4j.Result) {
+			v, ok := n.unpackWikiData(r, "i", "t")
+			if ok {
+				found = append(found, v)
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.NewWikiLookup(ids, titles, found), nil
+}
+
+// SearchArticlesByTitle will search through articles by their
+// title and return matches, skipping the first <offset> ones
+// and returning at most <limit>.
+func (n *Neo4jManager) SearchArticlesByTitle(
+	ctx context.Context, title string, offset, limit int) ([]*db.WikiData, error,
+) {
+	res := make([]*db.WikiData, 0, 5) // # 5 is arbitrary.
+	cql := `
+		MATCH (v:WikiData {title:$title}) RETURN v.pageid as i, v.title as t
+		ORDER BY i SKIP $offset LIMIT $limit
+	`
+	err := n.execute(ctx, executeParams{
+		cypher: cql,
+		bindings: map[string]interface{}{
+			"title": title, "offset": offset, "limit": limit},
+		callback: func(r neo4j.Result) {
+			v, ok := n.unpackWikiData(r, "i", "t")
+			if ok {
+				res = append(res, v)
+			}
+		},
+	})
+	return res, err
+}
+
+// SearchArticlesByTitleFuzzy is meant for autocompletion, it
+// will search through articles by title, case-insensitively,
+// where titles can match either by prefix or with a few typos.
+// See db.RankTitles for details on matching and ordering. This
+// requires an index named 'ArticleTitleIndex':
+// 	CALL db.index.fulltext.createNodeIndex(
+//		"ArticleTitleIndex",["WikiData"],["title"])
+func (n *Neo4jManager) SearchArticlesByTitleFuzzy(
+	ctx context.Context, str string, limit int) ([]*db.WikiData, error,
+) {
+	// # Every term has to match, either by prefix or fuzzily.
+	// # Terms are letters & digits only, so no Lucene escaping.
+	terms := db.SearchTerms(str)
+	if len(terms) == 0 {
+		return []*db.WikiData{}, nil
+	}
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		parts = append(parts, fmt.Sprintf("(%s* OR %s~)", term, term))
+	}
+	// # Lucene ranking doesn't favour prefixes the way we want, so
+	// # fetch plenty of candidates and let db.RankTitles order them.
+	candidates := make([]*db.WikiData, 0, limit*titleFuzzyCandidates)
+	cql := `
+		CALL db.index.fulltext.queryNodes(
+			"ArticleTitleIndex", $query
+		) YIELD node
+		RETURN node.pageid as i, node.title as t LIMIT $limit
+	`
+	err := n.execute(ctx, executeParams{
+		cypher: cql,
+		bindings: map[string]interface{}{
+			"query": strings.Join(parts, " AND "),
+			"limit": limit * titleFuzzyCandidates},
+		callback: func(r neo4j.Result) {
+			v, ok := n.unpackWikiData(r, "i", "t")
+			if ok {
+				candidates = append(candidates, v)
+			}
+		},
+	})
+	return db.RankTitles(str, candidates, limit), err
+}
+
 // SearchArticlesByContent will do a full-text search through
 // the database for content that contains the specified string.
 // This will be a search on an index named 'ArticleContantIndex'
 // so thah must be enabled with the following indexing:
 // 	CALL db.index.fulltext.createNodeIndex(
 //		"ArticleContentIndex",["WikiData"],["content"])
+// Results are ordered by relevance, where the first <offset>
+// ones are skipped and at most <limit> are returned. Each
+// result has a score and a highlighted snippet, see db.Snippet.
 func (n *Neo4jManager) SearchArticlesByContent(
-	str string, limit int) ([]*db.WikiData, error,
+	ctx context.Context, str string, offset, limit int) ([]*db.WikiSearchHit, error,
 ) {
-	res := make([]*db.WikiData, 0, limit)
+	res := make([]*db.WikiSearchHit, 0, limit)
+	// # Only a window of the content (around the first term found)
+	// # is returned, as articles can be large, see db.SnippetWindow.
 	cql := `
 		CALL db.index.fulltext.queryNodes(
 			"ArticleContentIndex", $str
-		) YIELD node
-		RETURN id(node) as i, node.title as t LIMIT $limit 
+		) YIELD node, score
+		 WITH node, score
+		 SKIP $offset LIMIT $limit
+		 WITH node, score, coalesce(node.content, '') as content
+		 WITH node, score, content, toLower(content) as lc
+		 WITH node, score, content, reduce(at = -1, term IN $terms |
+				CASE WHEN NOT lc CONTAINS term THEN at
+					 WHEN at >= 0 AND at < size(split(lc, term)[0]) THEN at
+					 ELSE size(split(lc, term)[0])
+				END) as at
+		 WITH node, score, content,
+				CASE WHEN at > $pad THEN at - $pad ELSE 0 END as cut
+		RETURN node.pageid as i, node.title as t, score as s,
+				substring(content, cut, $window) as c, cut as cf,
+				size(content) > cut + $window as cm
 	`
-	err := n.execute(executeParams{
-		cypher:   cql,
-		bindings: map[string]interface{}{"str": str, "limit": limit},
+	err := n.execute(ctx, executeParams{
+		cypher: cql,
+		bindings: map[string]interface{}{
+			"str": str, "offset": offset, "limit": limit,
+			"terms": db.SearchTerms(str), "pad": db.SnippetWindowPad,
+			"window": 3 * db.SnippetWindowPad},
 		callback: func(r neo4j.Result) {
-			v, ok := n.unpackWikiData(r, "i", "t")
+			v, ok := n.unpackWikiSearchHit(r, "i", "t", "s", "c", "cf", "cm", str)
 			if ok {
 				res = append(res, v)
 			}
@@ -105,22 +248,22 @@ func (n *Neo4jManager) SearchArticlesByContent(
 // SearchArticlesNeightsByIDs will search for article 'A'
 // by its ID and return articles that were linked from 'A'.
 func (n *Neo4jManager) SearchArticlesNeighsByID(
-	id int64, limit int) ([]*db.WikiData, error,
+	ctx context.Context, id int64, limit int) ([]*db.WikiData, error,
 ) {
 	res := make([]*db.WikiData, 0, limit)
 	cql := `
 		 MATCH (v:WikiData)-[rel:HYPERLINKS]->(w:WikiData)
-		 WHERE id(v) = $id
+		 WHERE v.pageid = $id
 		  WITH w,
 		  CASE
 		  		WHEN NOT EXISTS(rel.lookups) THEN 1 * rand()
 				ELSE rel.lookups * rand()
 		END AS ord
-		RETURN id(w) as i, w.title as t
+		RETURN w.pageid as i, w.title as t
 		 ORDER BY ord DESC
 		 LIMIT $limit
 	`
-	err := n.execute(executeParams{
+	err := n.execute(ctx, executeParams{
 		cypher:   cql,
 		bindings: map[string]interface{}{"id": id, "limit": limit},
 		callback: func(r neo4j.Result) {
@@ -133,16 +276,104 @@ func (n *Neo4jManager) SearchArticlesNeighsByID(
 	return res, err
 }
 
+// SearchArticlesBacklinksByID is the counterpart of
+// SearchArticlesNeighsByID, it will search for article 'A'
+// by its ID and return articles that link to 'A'.
+func (n *Neo4jManager) SearchArticlesBacklinksByID(
+	ctx context.Context, id int64, limit int) ([]*db.WikiData, error,
+) {
+	res := make([]*db.WikiData, 0, limit)
+	cql := `
+		 MATCH (v:WikiData)-[rel:HYPERLINKS]->(w:WikiData)
+		 WHERE w.pageid = $id
+		  WITH v,
+		  CASE
+		  		WHEN NOT EXISTS(rel.lookups) THEN 1 * rand()
+				ELSE rel.lookups * rand()
+		END AS ord
+		RETURN v.pageid as i, v.title as t
+		 ORDER BY ord DESC
+		 LIMIT $limit
+	`
+	err := n.execute(ctx, executeParams{
+		cypher:   cql,
+		bindings: map[string]interface{}{"id": id, "limit": limit},
+		callback: func(r neo4j.Result) {
+			v, ok := n.unpackWikiData(r, "i", "t")
+			if ok {
+				res = append(res, v)
+			}
+		},
+	})
+	return res, err
+}
+
+// SearchSubgraphByID will search for article 'A' by its ID
+// and return the articles within <depth> links from 'A' (by
+// following HYPERLINKS outwards), along with all HYPERLINKS
+// among those articles. At most <limit> articles are added
+// per level, where links with more lookups are preferred.
+func (n *Neo4jManager) SearchSubgraphByID(
+	ctx context.Context, id int64, depth, limit int) (*db.WikiGraph, error,
+) {
+	res := &db.WikiGraph{Nodes: make([]*db.WikiData, 0), Edges: make([][3]int64, 0)}
+	root, err := n.SearchArticlesByID(ctx, id)
+	if err != nil || len(root) == 0 {
+		return res, err
+	}
+	res.Nodes = append(res.Nodes, root[0])
+
+	// # Expand level by level, where frontier is the previous level.
+	seen := []int64{id}
+	frontier := []int64{id}
+	cql := `
+		UNWIND $frontier as fID
+		 MATCH (v:WikiData)-[r:HYPERLINKS]->(w:WikiData)
+		 WHERE v.pageid = fID
+		   AND NOT w.pageid IN $seen
+		  WITH w, max(coalesce(r.lookups, 0)) as l
+		RETURN w.pageid as i, w.title as t
+		 ORDER BY l DESC, i
+		 LIMIT $limit
+	`
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		next := make([]int64, 0, limit)
+		err := n.execute(ctx, executeParams{
+			cypher: cql,
+			bindings: map[string]interface{}{
+				"frontier": frontier, "seen": seen, "limit": limit},
+			callback: func(r neo4j.Result) {
+				v, ok := n.unpackWikiData(r, "i", "t")
+				if ok {
+					res.Nodes = append(res.Nodes, v)
+					next = append(next, v.ID)
+				}
+			},
+		})
+		if err != nil {
+			return res, err
+		}
+		seen = append(seen, next...)
+		frontier = next
+	}
+
+	// # All edges among the collected articles.
+	res.Edges, err = n.SearchRelsAmongIDs(ctx, seen)
+	return res, err
+}
+
 // SearchArticlesHTMLByID will get the HTML from an article
 // with the specified ID.
-func (n *Neo4jManager) SearchArticlesHTMLByID(id int64) (string, error) {
+func (n *Neo4jManager) SearchArticlesHTMLByID(
+	ctx context.Context, id int64) (string, error,
+) {
 	res := ""
 	cql := `
 		MATCH (v:WikiData)
-		WHERE id(v) = $id
+		WHERE v.pageid = $id
 		RETURN v.html as html 
 	`
-	err := n.execute(executeParams{
+	err := n.execute(ctx, executeParams{
 		cypher:   cql,
 		bindings: map[string]interface{}{"id": id},
 		callback: func(r neo4j.Result) {
@@ -156,6 +387,46 @@ func (n *Neo4jManager) SearchArticlesHTMLByID(id int64) (string, error) {
 
 }
 
+// SearchArticlesPathByIDs will search for the shortest chain
+// of articles that link (HYPERLINKS) from article 'A' to 'B',
+// by their IDs. The chain can be at most <maxDepth> links long.
+// The result starts with 'A' and ends with 'B', it is empty if
+// there is no such chain.
+func (n *Neo4jManager) SearchArticlesPathByIDs(
+	ctx context.Context, fromID, toID int64, maxDepth int) ([]*db.WikiData, error,
+) {
+	// # shortestPath doesn't allow the same start and end node.
+	if fromID == toID {
+		return n.SearchArticlesByID(ctx, fromID)
+	}
+	res := make([]*db.WikiData, 0, maxDepth+1)
+	if maxDepth < 1 {
+		return res, nil
+	}
+	// # Variable length bounds can't be parameterised, but
+	// # maxDepth is an int so formatting it in is safe.
+	cql := fmt.Sprintf(`
+		MATCH (v:WikiData), (w:WikiData)
+		WHERE v.pageid = $fromID
+		  AND w.pageid = $toID
+		MATCH p = shortestPath((v)-[:HYPERLINKS*..%d]->(w))
+	   UNWIND nodes(p) as x
+	   RETURN x.pageid as i, x.title as t
+	`, maxDepth)
+	err := n.execute(ctx, executeParams{
+		cypher: cql,
+		bindings: map[string]interface{}{
+			"fromID": fromID, "toID": toID},
+		callback: func(r neo4j.Result) {
+			v, ok := n.unpackWikiData(r, "i", "t")
+			if ok {
+				res = append(res, v)
+			}
+		},
+	})
+	return res, err
+}
+
 // CheckRelsExistByIDs will check if there is a relationship
 // between articles, i.e if one links another. The Expected
 // argument should be an slice containing another two-element
@@ -165,69 +436,144 @@ func (n *Neo4jManager) SearchArticlesHTMLByID(id int64) (string, error) {
 // another article with id 2, then the query [[1,2]] will
 // field [true]. If there was no relationship, then the
 // result is [false]. This applies to all nested slices.
-func (n *Neo4jManager) CheckRelsExistByIDs(relIDs [][2]int64) ([]bool, error,
+func (n *Neo4jManager) CheckRelsExistByIDs(
+	ctx context.Context, relIDs [][2]int64) ([]bool, error,
 ) {
-	res := make([]bool, len(relIDs))
-	cql := `
-		MATCH (v:WikiData)-[:HYPERLINKS]->(w:WikiData)
-		WHERE id(v) = $vID
-		  AND id(w) = $wID
-	   RETURN v.title, w.title 
-	`
-	for i := 0; i < len(relIDs); i++ {
-		err := n.execute(executeParams{
-			cypher: cql,
-			bindings: map[string]interface{}{
-				"vID": relIDs[i][0], "wID": relIDs[i][1]},
-			callback: func(r neo4j.Result) {
-				if len(r.Record().Values()) > 0 {
-					res[i] = true
-				}
-			},
-		})
-		if err != nil {
-			return res, err
-		}
+	checks, err := n.CheckRelsByIDs(ctx, relIDs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]bool, len(checks))
+	for i, c := range checks {
+		res[i] = c.Exists
 	}
 	return res, nil
 }
 
-// RandomArticles will return a specified amount of
-// randomly picked articles.
-func (n *Neo4jManager) RandomArticles(amount int) ([]*db.WikiData, error,
+// CheckRelsByIDs is like CheckRelsExistByIDs, but with the
+// lookups weight of each relationship. All pairs are checked
+// in a single query, where only existing rels give a row.
+func (n *Neo4jManager) CheckRelsByIDs(
+	ctx context.Context, relIDs [][2]int64) ([]db.WikiRelCheck, error,
 ) {
-	res := make([]*db.WikiData, 0, amount)
+	res := make([]db.WikiRelCheck, len(relIDs))
+	rows := make([]interface{}, len(relIDs))
+	for i, rel := range relIDs {
+		rows[i] = map[string]interface{}{"i": i, "v": rel[0], "w": rel[1]}
+	}
 	cql := `
-	    MATCH (v:WikiData)
-	     WITH v, rand() as r
-	   RETURN id(v) as i, v.title as t
-	    ORDER BY r
-	    LIMIT $amount
+		UNWIND $rels AS rel
+		 MATCH (v:WikiData {pageid: rel.v})-[r:HYPERLINKS]->(w:WikiData {pageid: rel.w})
+		RETURN rel.i as i, coalesce(r.lookups, 0) as l
 	`
-	err := n.execute(executeParams{
+	err := n.execute(ctx, executeParams{
 		cypher:   cql,
-		bindings: map[string]interface{}{"amount": amount},
+		bindings: map[string]interface{}{"rels": rows},
 		callback: func(r neo4j.Result) {
-			v, ok := n.unpackWikiData(r, "i", "t")
-			if ok {
-				res = append(res, v)
+			i, ok1 := n.unpackInt64(r, "i")
+			l, ok2 := n.unpackInt64(r, "l")
+			if ok1 && ok2 && i >= 0 && int(i) < len(res) {
+				res[i] = db.WikiRelCheck{Exists: true, Lookups: l}
 			}
 		},
 	})
 	return res, err
 }
 
+// SearchRelsAmongIDs returns all HYPERLINKS relationships among
+// the articles with <ids>, of form [from id, to id, lookups].
+func (n *Neo4jManager) SearchRelsAmongIDs(
+	ctx context.Context, ids []int64) ([][3]int64, error,
+) {
+	res := make([][3]int64, 0)
+	cql := `
+		MATCH (v:WikiData)-[r:HYPERLINKS]->(w:WikiData)
+		WHERE v.pageid IN $ids
+		  AND w.pageid IN $ids
+	   RETURN v.pageid as v, w.pageid as w, coalesce(r.lookups, 0) as l
+	`
+	err := n.execute(ctx, executeParams{
+		cypher:   cql,
+		bindings: map[string]interface{}{"ids": ids},
+		callback: func(r neo4j.Result) {
+			v, ok1 := n.unpackInt64(r, "v")
+			w, ok2 := n.unpackInt64(r, "w")
+			l, ok3 := n.unpackInt64(r, "l")
+			if ok1 && ok2 && ok3 {
+				res = append(res, [3]int64{v, w, l})
+			}
+		},
+	})
+	return res, err
+}
+
+// Cypher of each optional field for FillArticleFields, where v is
+// the article. Summaries are made from the content for articles
+// added without one, see db.Summary.
+var fieldsCypher = map[string]string{
+	db.FieldSummary: `v.summary as summary,
+		CASE WHEN v.summary IS NULL THEN left(v.content, $lead) END as lead`,
+	db.FieldOutDegree:  `size((v)-[:HYPERLINKS]->()) as outDegree`,
+	db.FieldInDegree:   `size((v)<-[:HYPERLINKS]-()) as inDegree`,
+	db.FieldLookups:    `reduce(s = 0, l IN [(v)<-[r:HYPERLINKS]-() | coalesce(r.lookups, 0)] | s + l) as lookups`,
+	db.FieldCategories: `v.categories as categories`,
+	db.FieldUpdated:    `v.updated as updated`,
+}
+
+// FillArticleFields sets the optional <fields> (see db.Fields) of
+// all <data> in place, by their IDs, in one go. Only the requested
+// fields are queried, as degrees & lookups need to visit links.
+func (n *Neo4jManager) FillArticleFields(
+	ctx context.Context, data []*db.WikiData, fields []string) error {
+	byID := make(map[int64][]*db.WikiData, len(data))
+	ids := make([]int64, 0, len(data))
+	for _, d := range data {
+		if len(byID[d.ID]) == 0 {
+			ids = append(ids, d.ID)
+		}
+		byID[d.ID] = append(byID[d.ID], d)
+	}
+	returns := []string{"v.pageid as i"}
+	for _, f := range fields {
+		// # Unknown fields are ignored, so only
+		// # constant cypher is formatted in.
+		if cql, ok := fieldsCypher[f]; ok {
+			returns = append(returns, cql)
+		}
+	}
+	cql := fmt.Sprintf(`
+		UNWIND $ids AS id
+		 MATCH (v:WikiData {pageid: id})
+		RETURN %s
+	`, strings.Join(returns, ", "))
+	// # Runes are at most 4 bytes, so this is enough for a summary.
+	lead := db.SummaryWidth * 4
+	return n.execute(ctx, executeParams{
+		cypher:   cql,
+		bindings: map[string]interface{}{"ids": ids, "lead": lead},
+		callback: func(r neo4j.Result) {
+			id, ok := n.unpackInt64(r, "i")
+			if !ok {
+				return
+			}
+			for _, d := range byID[id] {
+				n.unpackFields(r, d, fields)
+			}
+		},
+	})
+}
+
 // IncrementRel increments the relationship between two nodes with
 // the given IDs. The incremented relationship is of type HYPERLINKS,
 // where property is 'lookups'. This method is intended to be used
 // for increments such for the purpose of treating the graph as a
 // markov-chain (for article recommendation). Note, the 'lookups'
 // property does not need to exist before using this method.
-func (n *Neo4jManager) IncrementRel(vID, wID int64) error {
+func (n *Neo4jManager) IncrementRel(ctx context.Context, vID, wID int64) error {
 	cql := `
 		MATCH (v:WikiData)-[r:HYPERLINKS]->(w:WikiData)
-		WHERE id(v) = $vID
-		  AND id(w) = $wID
+		WHERE v.pageid = $vID
+		  AND w.pageid = $wID
 		WITH r,
 		CASE
 			WHEN NOT EXISTS(r.lookups) THEN 1
@@ -235,9 +581,164 @@ func (n *Neo4jManager) IncrementRel(vID, wID int64) error {
 		END as upd
 		SET r.lookups = upd
 	`
-	return n.execute(executeParams{
+	return n.execute(ctx, executeParams{
 		cypher: cql,
 		bindings: map[string]interface{}{
 			"vID": vID, "wID": wID},
+		write: true,
+	})
+}
+
+// ---------- writer prefabs below --------- //
+
+// AddArticles adds articles in one go, keyed by title. So
+// adding an article with a title that already exists will
+// update the content, html, summary and categories of the
+// existing one (which keeps its id), and 'updated' is set to
+// the current time (ms). New articles get their StableID as
+// id, which must be unique, see EnsureSchema. For this to be fast on
+// large graphs, titles should be indexed:
+// 	CREATE INDEX ON :WikiData(title)
+func (n *Neo4jManager) AddArticles(
+	ctx context.Context, articles []*db.WikiArticle) error {
+	rows := make([]interface{}, 0, len(articles))
+	for _, a := range articles {
+		categories := a.Categories
+		if categories == nil {
+			categories = []string{}
+		}
+		row := map[string]interface{}{"id": a.StableID(),
+			"title": a.Title, "content": a.Content, "html": a.HTML,
+			"summary": a.SummaryOrLead(), "categories": categories}
+		// # Left out means null, i.e unset.
+		if a.LegacyID != nil {
+			row["legacy"] = *a.LegacyID
+		}
+		rows = append(rows, row)
+	}
+	cql := `
+		UNWIND $articles AS a
+		 MERGE (v:WikiData {title:a.title})
+		   SET v.content = a.content, v.html = a.html,
+		       v.summary = a.summary, v.categories = a.categories,
+		       v.updated = timestamp(),
+		       v.pageid = coalesce(v.pageid, a.id),
+		       v.legacyid = coalesce(a.legacy, v.legacyid)
+	`
+	return n.execute(ctx, executeParams{
+		cypher:   cql,
+		bindings: map[string]interface{}{"articles": rows},
+		write:    true,
 	})
 }
+
+// AddRels adds HYPERLINKS relationships in one go, where
+// articles are referred to by title. Rels that refer to
+// non-existent articles are skipped. If Lookups is set on
+// a rel, then it overwrites the 'lookups' property.
+func (n *Neo4jManager) AddRels(ctx context.Context, rels []*db.WikiRel) error {
+	rows := make([]interface{}, 0, len(rels))
+	for _, r := range rels {
+		rows = append(rows, map[string]interface{}{
+			"from": r.From, "to": r.To, "lookups": r.Lookups})
+	}
+	cql := `
+		UNWIND $rels AS r
+		 MATCH (v:WikiData {title:r.from})
+		 MATCH (w:WikiData {title:r.to})
+		 MERGE (v)-[l:HYPERLINKS]->(w)
+		  WITH l, r
+		 WHERE r.lookups > 0
+		   SET l.lookups = r.lookups
+	`
+	return n.execute(ctx, executeParams{
+		cypher:   cql,
+		bindings: map[string]interface{}{"rels": rows},
+		write:    true,
+	})
+}
+
+// -------- iterator prefabs below --------- //
+
+// EachArticle calls <f> for every article. If <full> is false,
+// then only ids & titles are fetched (content & html are left empty).
+// Iteration stops at the first error returned by <f>, that
+// error is then returned.
+func (n *Neo4jManager) EachArticle(
+	ctx context.Context, full bool, f func(*db.WikiArticle) error,
+) error {
+	cql := `
+		MATCH (v:WikiData)
+		RETURN v.pageid as i, v.legacyid as l, v.title as t,
+		       v.content as c, v.html as h,
+		       v.summary as s, v.categories as g
+	`
+	if !full {
+		cql = `
+			MATCH (v:WikiData)
+			RETURN v.pageid as i, v.legacyid as l, v.title as t
+		`
+	}
+	// # Cancelled once f fails, so that execute stops reading.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var ferr error
+	err := n.execute(ctx, executeParams{
+		cypher: cql,
+		callback: func(r neo4j.Result) {
+			a := db.WikiArticle{}
+			a.ID, _ = n.unpackInt64(r, "i")
+			if l, ok := n.unpackInt64(r, "l"); ok {
+				a.LegacyID = &l
+			}
+			a.Title, _ = n.unpackString(r, "t")
+			if full {
+				a.Content, _ = n.unpackString(r, "c")
+				a.HTML, _ = n.unpackString(r, "h")
+				a.Summary, _ = n.unpackString(r, "s")
+				a.Categories, _ = n.unpackStrings(r, "g")
+			}
+			if ferr = f(&a); ferr != nil {
+				cancel()
+			}
+		},
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// EachRel calls <f> for every HYPERLINKS relationship, where
+// iteration stops the same way as with EachArticle.
+func (n *Neo4jManager) EachRel(
+	ctx context.Context, f func(*db.WikiRel) error) error {
+	cql := `
+		MATCH (v:WikiData)-[r:HYPERLINKS]->(w:WikiData)
+		RETURN v.title as f, w.title as t, r.lookups as l,
+		       v.pageid as fi, w.pageid as ti
+	`
+	// # Same as EachArticle, cancelled once f fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var ferr error
+	err := n.execute(ctx, executeParams{
+		cypher: cql,
+		callback: func(r neo4j.Result) {
+			rel := db.WikiRel{}
+			rel.From, _ = n.unpackString(r, "f")
+			rel.To, _ = n.unpackString(r, "t")
+			// # Not ok when 'lookups' doesn't exist, i.e 0.
+			rel.Lookups, _ = n.unpackInt64(r, "l")
+			rel.FromID, _ = n.unpackInt64(r, "fi")
+			rel.ToID, _ = n.unpackInt64(r, "ti")
+			if ferr = f(&rel); ferr != nil {
+				cancel()
+			}
+		},
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package neo4j
+
+import (
+	"context"
+	"math"
+	"math/rand"
+
+	"github.com/neo4j/neo4j-go-driver/neo4j"
+	"wikinodes-server/db"
+)
+
+// This file contains the random sampling of articles. Shuffling
+// all articles (ORDER BY rand()) scans & sorts the whole graph,
+// so instead random points in the range of stable ids are picked,
+// and each point is resolved to the first article at or after it
+// with an index seek on 'pageid'. An article is thus picked with
+// odds proportional to the gap before its id, which is roughly
+// uniform since stable ids are hashes, see db.StableID. Filtered
+// samples can come up short on large graphs, rather than scanning.
+
+// sampleRounds is how many rounds of random points are tried
+// before falling back to a scan, see sampleScanMax.
+const sampleRounds = 3
+
+// sampleSeekMax is how many articles are read from each random
+// point, looking for one that passes the filters. Points where
+// none does are skipped, so restrictive filters don't turn seeks
+// into index scans.
+const sampleSeekMax = 100
+
+// sampleScanMax is how many articles a graph can have for the
+// fallback scan of SampleArticles, which fills up samples that
+// came up short. Larger graphs get short samples instead.
+const sampleScanMax = 10000
+
+// RandomArticles will return a specified amount of
+// randomly picked articles.
+func (n *Neo4jManager) RandomArticles(
+	ctx context.Context, amount int) ([]*db.WikiData, error,
+) {
+	return n.SampleArticles(ctx, db.SampleOptions{Amount: amount})
+}
+
+// SampleArticles returns up to <opts.Amount> randomly picked
+// articles, see db.SampleOptions for the filters.
+func (n *Neo4jManager) SampleArticles(
+	ctx context.Context, opts db.SampleOptions) ([]*db.WikiData, error,
+) {
+	rng := opts.Rand()
+	if opts.Amount <= 0 {
+		return []*db.WikiData{}, nil
+	}
+	// # Neighbours are bounded by the out-degree, so
+	// # they're simply fetched & sampled in full.
+	if opts.NeighOf != nil {
+		cql := `
+			MATCH (:WikiData {pageid: $id})-[:HYPERLINKS]->(w:WikiData)
+			WHERE size((w)<-[:HYPERLINKS]-()) >= $minIn
+		   RETURN w.pageid as i, w.title as t
+			ORDER BY i
+		`
+		return n.sampleFrom(ctx, cql, map[string]interface{}{
+			"id": *opts.NeighOf, "minIn": opts.MinInDegree,
+		}, opts.Amount, rng)
+	}
+
+	lo, hi, count, err := n.pageIDStats(ctx)
+	if err != nil || count == 0 {
+		return []*db.WikiData{}, err
+	}
+	res := make([]*db.WikiData, 0, opts.Amount)
+	seen := make(map[int64]bool, opts.Amount)
+	for round := 0; round < sampleRounds && len(res) < opts.Amount; round++ {
+		// # Twice the points needed, as some will
+		// # resolve to the same (or an already seen) one.
+		starts := make([]int64, 2*(opts.Amount-len(res)))
+		for i := range starts {
+			starts[i] = randInRange(rng, lo, hi)
+		}
+		cql := `
+			UNWIND range(0, size($starts) - 1) AS k
+			  CALL {
+				  WITH k
+				 MATCH (v:WikiData)
+				 WHERE v.pageid >= $starts[k]
+				  WITH v
+				 ORDER BY v.pageid
+				 LIMIT $seek
+				  WITH v
+				 WHERE size((v)<-[:HYPERLINKS]-()) >= $minIn
+				RETURN v
+				 ORDER BY v.pageid
+				 LIMIT 1
+			  }
+			RETURN v.pageid as i, v.title as t
+			 ORDER BY k
+		`
+		err := n.execute(ctx, executeParams{
+			cypher: cql,
+			bindings: map[string]interface{}{
+				"starts": starts, "minIn": opts.MinInDegree,
+				"seek": sampleSeekMax},
+			callback: func(r neo4j.Result) {
+				v, ok := n.unpackWikiData(r, "i", "t")
+				if ok && !seen[v.ID] && len(res) < opts.Amount {
+					seen[v.ID] = true
+					res = append(res, v)
+				}
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(res) == opts.Amount || count > sampleScanMax {
+		return res, nil
+	}
+
+	// # Few articles to pick from, so a scan is cheap enough.
+	have := make([]int64, 0, len(res))
+	for _, v := range res {
+		have = append(have, v.ID)
+	}
+	cql := `
+		MATCH (v:WikiData)
+		WHERE size((v)<-[:HYPERLINKS]-()) >= $minIn
+		  AND NOT v.pageid IN $have
+	   RETURN v.pageid as i, v.title as t
+		ORDER BY i
+	`
+	rest, err := n.sampleFrom(ctx, cql, map[string]interface{}{
+		"minIn": opts.MinInDegree, "have": have,
+	}, opts.Amount-len(res), rng)
+	return append(res, rest...), err
+}
+
+// pageIDStats returns the lowest & highest stable id, along with
+// the amount of articles. The ids are index seeks and the amount
+// comes from the count store, so this is cheap.
+func (n *Neo4jManager) pageIDStats(ctx context.Context,
+) (lo, hi, count int64, err error) {
+	cql := `
+		CALL {
+			MATCH (v:WikiData) WHERE v.pageid IS NOT NULL
+		   RETURN v.pageid as lo ORDER BY v.pageid LIMIT 1
+		}
+		CALL {
+			MATCH (v:WikiData) WHERE v.pageid IS NOT NULL
+		   RETURN v.pageid as hi ORDER BY v.pageid DESC LIMIT 1
+		}
+		CALL {
+			MATCH (v:WikiData) RETURN count(v) as n
+		}
+	   RETURN lo, hi, n
+	`
+	err = n.execute(ctx, executeParams{
+		cypher: cql,
+		callback: func(r neo4j.Result) {
+			var okLo, okHi bool
+			lo, okLo = n.unpackInt64(r, "lo")
+			hi, okHi = n.unpackInt64(r, "hi")
+			if okLo && okHi {
+				count, _ = n.unpackInt64(r, "n")
+			}
+		},
+	})
+	return lo, hi, count, err
+}
+
+// randInRange returns a random int64 in [lo, hi], for any ids
+// (imports keep given ids, which might span all of int64).
+func randInRange(rng *rand.Rand, lo, hi int64) int64 {
+	// # Unsigned, so the span can't overflow.
+	span := uint64(hi) - uint64(lo)
+	if span == math.MaxUint64 {
+		return int64(rng.Uint64())
+	}
+	if span < math.MaxInt64 {
+		return lo + rng.Int63n(int64(span)+1)
+	}
+	return int64(uint64(lo) + rng.Uint64()%(span+1))
+}
+
+// sampleFrom runs <cql>, which returns candidates as (i, t) in
+// a fixed order, and picks up to <amount> of them with <rng>.
+func (n *Neo4jManager) sampleFrom(ctx context.Context, cql string,
+	bindings map[string]interface{}, amount int, rng *rand.Rand,
+) ([]*db.WikiData, error) {
+	ids := make([]int64, 0)
+	byID := make(map[int64]*db.WikiData)
+	err := n.execute(ctx, executeParams{
+		cypher:   cql,
+		bindings: bindings,
+		callback: func(r neo4j.Result) {
+			v, ok := n.unpackWikiData(r, "i", "t")
+			if ok {
+				ids = append(ids, v.ID)
+				byID[v.ID] = v
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	picked := db.SampleIDs(ids, amount, rng)
+	res := make([]*db.WikiData, 0, len(picked))
+	for _, id := range picked {
+		res = append(res, byID[id])
+	}
+	return res, nil
+}
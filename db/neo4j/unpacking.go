@@ -1,6 +1,7 @@
 package neo4j
 
 import (
+	"time"
 	"wikinodes-server/db"
 
 	"github.com/neo4j/neo4j-go-driver/neo4j"
@@ -38,6 +39,95 @@ func (n *Neo4jManager) unpackString(
 	return res, ok
 }
 
+// Unpack into float64, using the alias specified in CQL.
+func (n *Neo4jManager) unpackFloat64(
+	r neo4j.Result, alias string) (float64, bool,
+) {
+	// # Guard value exists.
+	v, ok := r.Record().Get(alias)
+	if !ok {
+		return 0, false
+	}
+	// # Guard expected val type.
+	res, ok := v.(float64)
+	return res, ok
+}
+
+// Unpack into bool, using the alias specified in CQL.
+func (n *Neo4jManager) unpackBool(
+	r neo4j.Result, alias string) (bool, bool,
+) {
+	// # Guard value exists.
+	v, ok := r.Record().Get(alias)
+	if !ok {
+		return false, false
+	}
+	// # Guard expected val type.
+	res, ok := v.(bool)
+	return res, ok
+}
+
+// Unpack into []string, using the alias specified in CQL.
+// Lists come as []interface{}, where non-strings are skipped.
+func (n *Neo4jManager) unpackStrings(
+	r neo4j.Result, alias string) ([]string, bool,
+) {
+	// # Guard value exists.
+	v, ok := r.Record().Get(alias)
+	if !ok {
+		return nil, false
+	}
+	// # Guard expected val type.
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	res := make([]string, 0, len(list))
+	for _, x := range list {
+		if s, ok := x.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res, true
+}
+
+// Unpack the optional <fields> of a WikiData into <d>, where
+// aliases are the field names (see fieldsCypher). Missing
+// values leave the field unset.
+func (n *Neo4jManager) unpackFields(
+	r neo4j.Result, d *db.WikiData, fields []string) {
+	int64Field := func(alias string) *int64 {
+		if x, ok := n.unpackInt64(r, alias); ok {
+			return &x
+		}
+		return nil
+	}
+	for _, f := range fields {
+		switch f {
+		case db.FieldSummary:
+			if s, ok := n.unpackString(r, "summary"); ok {
+				d.Summary = s
+			} else if lead, ok := n.unpackString(r, "lead"); ok {
+				d.Summary = db.Summary(lead, db.SummaryWidth)
+			}
+		case db.FieldOutDegree:
+			d.OutDegree = int64Field("outDegree")
+		case db.FieldInDegree:
+			d.InDegree = int64Field("inDegree")
+		case db.FieldLookups:
+			d.Lookups = int64Field("lookups")
+		case db.FieldCategories:
+			d.Categories, _ = n.unpackStrings(r, "categories")
+		case db.FieldUpdated:
+			// # Stored as ms since epoch, see AddArticles.
+			if ms, ok := n.unpackInt64(r, "updated"); ok {
+				t := time.Unix(0, ms*int64(time.Millisecond)).UTC()
+				d.Updated = &t
+			}
+		}
+	}
+}
+
 // Unpack neo4j result into db.WikiDataBrief.
 // Aliases are the string aliases used in the CQL.
 func (n *Neo4jManager) unpackWikiData(
@@ -54,3 +144,34 @@ func (n *Neo4jManager) unpackWikiData(
 	}
 	return &db.WikiData{ID: id, Title: title}, true
 }
+
+// Unpack neo4j result into db.WikiSearchHit, where the snippet
+// is made from a window of the content (alias), which starts at
+// the content from (alias) offset and might have more content
+// after it (alias), and search string <str>. Aliases are the
+// string aliases used in the CQL.
+func (n *Neo4jManager) unpackWikiSearchHit(
+	r neo4j.Result, aliasID, aliasTitle, aliasScore, aliasContent,
+	aliasContentFrom, aliasContentMore, str string) (
+	*db.WikiSearchHit, bool,
+) {
+	data, ok := n.unpackWikiData(r, aliasID, aliasTitle)
+	if !ok {
+		return nil, ok
+	}
+	score, ok := n.unpackFloat64(r, aliasScore)
+	if !ok {
+		return nil, ok
+	}
+	// # Content might be missing, that's fine for a snippet. It's
+	// # a window of the content, see db.SnippetWindow.
+	content, _ := n.unpackString(r, aliasContent)
+	from, _ := n.unpackInt64(r, aliasContentFrom)
+	more, _ := n.unpackBool(r, aliasContentMore)
+	return &db.WikiSearchHit{
+		WikiData: *data,
+		Score:    score,
+		Snippet: db.SnippetWindow(
+			content, int(from), more, str, db.SnippetWidth),
+	}, true
+}
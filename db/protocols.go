@@ -1,14 +1,38 @@
 package db
 
+import "context"
+
 // StoredWikiManager specifies interface for interacting with
-// a DB which keeps wikipedia articles.
+// a DB which keeps wikipedia articles. Methods that take a ctx
+// are expected to give up once it's done, returning ctx.Err()
+// or similar (this goes for the other interfaces here as well).
 type StoredWikiManager interface {
 	// SearchArticlesByID will search through articles by
 	// their IDs and return all matches.
-	SearchArticlesByID(id int64) ([]*WikiData, error)
-	// SearchArticlesByTitle will search through articles
-	// by their title and return all matches.
-	SearchArticlesByTitle(title string) ([]*WikiData, error)
+	SearchArticlesByID(ctx context.Context, id int64) ([]*WikiData, error)
+	// SearchArticlesByLegacyID will search through articles by
+	// the ids they had before stable ids (see StableID), for
+	// resolving old links. Articles added since have none.
+	SearchArticlesByLegacyID(ctx context.Context, legacyID int64) ([]*WikiData, error)
+	// LookupArticles looks up articles by <ids> and <titles> in one
+	// go, rather than one query per article, see WikiLookup.
+	LookupArticles(ctx context.Context,
+		ids []int64, titles []string) (*WikiLookup, error)
+	// SearchArticlesByTitle will search through articles by their
+	// title and return matches, skipping the first <offset> ones
+	// and returning at most <limit>.
+	SearchArticlesByTitle(ctx context.Context,
+		title string, offset, limit int) ([]*WikiData, error)
+
+	// SearchArticlesByTitleFuzzy is meant for autocompletion, it
+	// will search through articles by title, case-insensitively,
+	// where titles can match either by prefix or with a few typos.
+	// See RankTitles for details on matching and ordering. Using
+	// Neo4j, this requires an index named 'ArticleTitleIndex':
+	// 	CALL db.index.fulltext.createNodeIndex(
+	//		"ArticleTitleIndex",["WikiData"],["title"])
+	SearchArticlesByTitleFuzzy(ctx context.Context,
+		str string, limit int) ([]*WikiData, error)
 
 	// SearchArticlesByContent will do a full-text search through
 	// the database for content that contains the specified string.
@@ -16,13 +40,37 @@ type StoredWikiManager interface {
 	// so thah must be enabled with the following indexing:
 	// 	CALL db.index.fulltext.createNodeIndex(
 	//		"ArticleContentIndex",["WikiNode"],["content"])
-	SearchArticlesByContent(str string, limit int) ([]*WikiData, error)
+	// Results are ordered by relevance, where the first <offset>
+	// ones are skipped and at most <limit> are returned. Each
+	// result has a score and a highlighted snippet, see Snippet.
+	SearchArticlesByContent(ctx context.Context,
+		str string, offset, limit int) ([]*WikiSearchHit, error)
 	// SearchArticlesNeightsByIDs will search for article 'A'
 	// by its ID and return articles that were linked from 'A'.
-	SearchArticlesNeighsByID(id int64, limit int) ([]*WikiData, error)
+	SearchArticlesNeighsByID(ctx context.Context,
+		id int64, limit int) ([]*WikiData, error)
+	// SearchArticlesBacklinksByID is the counterpart of
+	// SearchArticlesNeighsByID, it will search for article 'A'
+	// by its ID and return articles that link to 'A'.
+	SearchArticlesBacklinksByID(ctx context.Context,
+		id int64, limit int) ([]*WikiData, error)
+	// SearchSubgraphByID will search for article 'A' by its ID
+	// and return the articles within <depth> links from 'A' (by
+	// following HYPERLINKS outwards), along with all HYPERLINKS
+	// among those articles. At most <limit> articles are added
+	// per level, where links with more lookups are preferred.
+	SearchSubgraphByID(ctx context.Context,
+		id int64, depth, limit int) (*WikiGraph, error)
 	// SearchArticlesHTMLByID will get the HTML from an article
 	// with the specified ID.
-	SearchArticlesHTMLByID(id int64) (string, error)
+	SearchArticlesHTMLByID(ctx context.Context, id int64) (string, error)
+	// SearchArticlesPathByIDs will search for the shortest chain
+	// of articles that link (HYPERLINKS) from article 'A' to 'B',
+	// by their IDs. The chain can be at most <maxDepth> links long.
+	// The result starts with 'A' and ends with 'B', it is empty if
+	// there is no such chain.
+	SearchArticlesPathByIDs(ctx context.Context,
+		fromID, toID int64, maxDepth int) ([]*WikiData, error)
 
 	// CheckRelsExistsByIDs will check if there is a relationship
 	// between articles, i.e if one links another. The Expected
@@ -33,11 +81,31 @@ type StoredWikiManager interface {
 	// another article with id 2, then the query [[1,2]] will
 	// field [true]. If there was no relationship, then the
 	// result is [false]. This applies to all nested slices.
-	CheckRelsExistByIDs(relIDs [][2]int64) ([]bool, error)
+	CheckRelsExistByIDs(ctx context.Context, relIDs [][2]int64) ([]bool, error)
+	// CheckRelsByIDs is like CheckRelsExistByIDs, but with the
+	// lookups weight of each relationship. All pairs are checked
+	// in one go, rather than one query per pair.
+	CheckRelsByIDs(ctx context.Context, relIDs [][2]int64) ([]WikiRelCheck, error)
+	// SearchRelsAmongIDs returns all HYPERLINKS relationships
+	// among the articles with <ids> (in both directions), of the
+	// same form as WikiGraph.Edges. This saves checking every
+	// pair of ids with CheckRelsByIDs.
+	SearchRelsAmongIDs(ctx context.Context, ids []int64) ([][3]int64, error)
 
 	// RandomArticles will return a specified amount of
 	// randomly picked articles.
-	RandomArticles(amount int) ([]*WikiData, error)
+	RandomArticles(ctx context.Context, amount int) ([]*WikiData, error)
+	// SampleArticles returns up to <opts.Amount> randomly picked
+	// articles, which can be narrowed down with filters, see
+	// SampleOptions. Unlike a shuffle of all articles, this
+	// should stay fast on large graphs.
+	SampleArticles(ctx context.Context, opts SampleOptions) ([]*WikiData, error)
+
+	// FillArticleFields sets the optional <fields> (see Fields) of
+	// all <data> in place, by their IDs, in one go. Fields of data
+	// without a matching article are left unset, as are fields not
+	// in <fields>.
+	FillArticleFields(ctx context.Context, data []*WikiData, fields []string) error
 
 	// IncrementRel increments the relationship between two nodes with
 	// the given IDs. The incremented relationship is of type HYPERLINKS,
@@ -45,7 +113,45 @@ type StoredWikiManager interface {
 	// for increments such for the purpose of treating the graph as a
 	// markov-chain (for article recommendation). Note, the 'lookups'
 	// property does not need to exist before using this method.
-	IncrementRel(vID, wID int64) error
+	IncrementRel(ctx context.Context, vID, wID int64) error
+
+	// Close releases the connections (or other resources) held,
+	// the manager can't be used afterwards. Intended to be called
+	// once the server has stopped handling requests.
+	Close() error
+}
+
+// StoredWikiWriter specifies interface for populating a DB
+// which keeps wikipedia articles. It's kept apart from the
+// StoredWikiManager since the server itself never writes
+// articles, only tools such as the importer do.
+type StoredWikiWriter interface {
+	// AddArticles adds articles in one go. Articles are keyed by
+	// title, so adding an article with a title that already exists
+	// will update the content, html, summary and categories of the
+	// existing one (and when it was updated, see WikiData). Each
+	// article gets its WikiArticle.StableID as id, which must be
+	// unique, and keeps its legacy id if set.
+	AddArticles(ctx context.Context, articles []*WikiArticle) error
+	// AddRels adds HYPERLINKS relationships in one go. Rels that
+	// refer to non-existent articles are skipped. If Lookups is
+	// set on a rel, then it overwrites the stored weight.
+	AddRels(ctx context.Context, rels []*WikiRel) error
+}
+
+// StoredWikiIterator specifies interface for walking through
+// all articles and relationships in a DB which keeps wikipedia
+// articles, such as when exporting the whole graph.
+type StoredWikiIterator interface {
+	// EachArticle calls <f> for every article. If <full> is false,
+	// then only ids & titles are set (content, html, summary and
+	// categories are left empty).
+	// Iteration stops at the first error returned by <f>, that
+	// error is then returned.
+	EachArticle(ctx context.Context, full bool, f func(*WikiArticle) error) error
+	// EachRel calls <f> for every HYPERLINKS relationship, where
+	// iteration stops the same way as with EachArticle.
+	EachRel(ctx context.Context, f func(*WikiRel) error) error
 }
 
 // CacheManager specifies interface for using a cache
@@ -55,15 +161,19 @@ type CacheManager interface {
 	// to be used for keeping track of which Wikipedia Articles a
 	// front-end client searches for, for the purpose of article
 	// recommendation.
-	SetLastQueryID(ip string, id int64) bool
+	SetLastQueryID(ctx context.Context, ip string, id int64) bool
 	// LastQueryID is the counterpart of SetLastQueryID, it simply
 	// tries to retrieve a Wikipedia Article for a given IP.
-	LastQueryID(ip string) (int64, bool)
+	LastQueryID(ctx context.Context, ip string) (int64, bool)
 
 	// Used to prevent service spam. Calling this method will
 	// increment the counter for an IP and check if it has
 	// exceeded an allowance over a time period (see pkg vars
 	// dosguardAllowance & dosguardExpiration). If True is
 	// returned, then the IP is good for more requests.
-	CheckRegDOSIP(ip string) (bool, error)
+	CheckRegDOSIP(ctx context.Context, ip string) (bool, error)
+
+	// Close releases the connections (or other resources) held,
+	// same as StoredWikiManager.Close.
+	Close() error
 }
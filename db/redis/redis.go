@@ -2,50 +2,64 @@ package redis
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-redis/redis/v8"
 	"strconv"
+	"time"
 	"wikinodes-server/config"
+	"wikinodes-server/db"
 )
 
 var (
-	ctx = context.Background()
+	// Namespace or ip:queryid(wiki) keys.
+	namespaceWikiID = "wikiID"
+	// Namespace of dosguard keys.
+	namespaceDosguard = "dg"
+)
+
+type RedisManager struct {
+	c *redis.Client
 	// How long to keep ip:queryid(wiki) alive.
 	// This is used to keep track of which Wikipedia
 	// article (neo4j db) IDs are used by IPs for
 	// the purpose of recommendations.
-	queryIDExpiration = config.QueryTrackExpiration
-	// Namespace or ip:queryid(wiki) keys.
-	namespaceWikiID = "wikiID"
+	queryIDExpiration time.Duration
 	// These two are used to prevent service
 	// spam. An IP is allowed to make x amount
 	// of requests per t amount of time, where
 	// x = dosguardAllowance and
 	// t = dosguardExpiration
-	dosguardExpiration = config.DOSGuardRefreshDelta
-	dosguardAllowance  = config.DOSGuardAllowancePerRefresh
-	namespaceDosguard  = "dg"
-)
-
-type RedisManager struct {
-	c *redis.Client
+	dosguardExpiration time.Duration
+	dosguardAllowance  int
 }
 
-// New sets up- and returns a RedisManager with a Redis client
-func New(ip, port, pwd string, db int) *RedisManager {
+// New sets up- and returns a RedisManager with a Redis client,
+// where <cache> has the expirations & allowance to use.
+func New(conf config.Redis, cache config.Cache) *RedisManager {
 	return &RedisManager{
 		c: redis.NewClient(&redis.Options{
-			Addr:     ip + ":" + port,
-			Password: pwd,
-			DB:       db,
-		})}
+			Addr:     conf.IP + ":" + conf.Port,
+			Password: conf.PWD,
+			DB:       conf.DB,
+		}),
+		queryIDExpiration:  cache.QueryTrackExpiration,
+		dosguardExpiration: cache.DOSGuardRefreshDelta,
+		dosguardAllowance:  cache.DOSGuardAllowancePerRefresh,
+	}
+}
+
+// Close closes the Redis client, along with its connection pool.
+func (r *RedisManager) Close() error {
+	return r.c.Close()
 }
 
 // SetLastQueryID tries to set a query id for an ip. Intenden
 // to be used for keeping track of which Wikipedia Articles a
 // front-end client searches for, for the purpose of article
 // recommendation.
-func (r *RedisManager) SetLastQueryID(ip string, id int64) bool {
-	err := r.c.Set(ctx, namespaceWikiID+ip, id, queryIDExpiration).Err()
+func (r *RedisManager) SetLastQueryID(
+	ctx context.Context, ip string, id int64) bool {
+	err := r.c.Set(ctx, namespaceWikiID+ip, id, r.queryIDExpiration).Err()
 	if err != nil {
 		return false
 	}
@@ -54,7 +68,7 @@ func (r *RedisManager) SetLastQueryID(ip string, id int64) bool {
 
 // LastQueryID is the counterpart of SetLastQueryID, it simply
 // tries to retrieve a Wikipedia Article for a given IP.
-func (r *RedisManager) LastQueryID(ip string) (int64, bool) {
+func (r *RedisManager) LastQueryID(ctx context.Context, ip string) (int64, bool) {
 	v, err := r.c.Get(ctx, namespaceWikiID+ip).Result()
 	if err != nil {
 		return 0, false
@@ -68,16 +82,30 @@ func (r *RedisManager) LastQueryID(ip string) (int64, bool) {
 
 // Used to prevent service spam. Calling this method will
 // increment the counter for an IP and check if it has
-// exceeded an allowance over a time period (see pkg vars
+// exceeded an allowance over a time period (see fields
 // dosguardAllowance & dosguardExpiration). If True is
-// returned, then the IP is good for more requests.
-func (r *RedisManager) CheckRegDOSIP(ip string) (bool, error) {
+// returned, then the IP is good for more requests. If
+// Redis can't be reached, then a db.ErrUnavailable is
+// returned (and nothing is allowed), whichever step fails.
+func (r *RedisManager) CheckRegDOSIP(
+	ctx context.Context, ip string) (bool, error) {
 	v, err := r.c.Get(ctx, namespaceDosguard+ip).Result()
+	// # Nothing is known if ctx is done, so don't reset.
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
 	// # If key doesn't exist, create it with fresh allowance.
-	if err != nil {
-		r.c.Set(ctx, namespaceDosguard+ip, 1, dosguardExpiration)
+	// # Only redis.Nil means that; anything else is an outage.
+	if err == redis.Nil {
+		err = r.c.Set(ctx, namespaceDosguard+ip, 1, r.dosguardExpiration).Err()
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", db.ErrUnavailable, err)
+		}
 		return true, nil
 	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", db.ErrUnavailable, err)
+	}
 	// # Shouldn't be a problem if this method is self-contained
 	// # since an int is guaranteed(?), given the block above.
 	// # But still...
@@ -86,10 +114,12 @@ func (r *RedisManager) CheckRegDOSIP(ip string) (bool, error) {
 		return false, err
 	}
 	// # Allowance exceeded.
-	if count+1 > dosguardAllowance {
+	if count+1 > r.dosguardAllowance {
 		return false, nil
 	}
 	// # Ok: Increment and allow.
-	err = r.c.Incr(ctx, namespaceDosguard+ip).Err()
-	return true, err
+	if err = r.c.Incr(ctx, namespaceDosguard+ip).Err(); err != nil {
+		return false, fmt.Errorf("%w: %v", db.ErrUnavailable, err)
+	}
+	return true, nil
 }
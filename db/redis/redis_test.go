@@ -1,20 +1,26 @@
 package redis
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
 )
 
 var (
 	ip   = "localhost"
 	port = "6379"
 	pwd  = ""
-	db   = 0
+	dbi  = 0
 	r    *RedisManager
+	ctx  = context.Background()
 )
 
 func init() {
-	r = New(ip, port, pwd, db)
+	conf := config.Redis{IP: ip, Port: port, PWD: pwd, DB: dbi}
+	r = New(conf, config.Default().Cache)
 }
 
 func TestSetGetLastQueryID(t *testing.T) {
@@ -24,50 +30,62 @@ func TestSetGetLastQueryID(t *testing.T) {
 	// # Prep.
 	r.c.Del(ctx, ip)
 
-	_, ok := r.LastQueryID(ip)
+	_, ok := r.LastQueryID(ctx, ip)
 	if ok {
 		t.Fatal("unexpected query success")
 	}
 
-	if ok := r.SetLastQueryID(ip, id); !ok {
+	if ok := r.SetLastQueryID(ctx, ip, id); !ok {
 		t.Fatal("failed while setting k:v")
 	}
 
-	v, ok := r.LastQueryID(ip)
+	v, ok := r.LastQueryID(ctx, ip)
 	if !ok || v != id {
 		t.Fatalf("unexpected query fail: %v, %v", v, ok)
 	}
 }
 
 func TestCheckRegDOSIP(t *testing.T) {
-	// # Backup pkg vars so it's safe to reduce
+	// # Backup fields so it's safe to reduce
 	// # allowance and expiration (so test is quicker).
-	dguardExpBackup := dosguardExpiration
-	dguardAllowBackup := dosguardAllowance
+	dguardExpBackup := r.dosguardExpiration
+	dguardAllowBackup := r.dosguardAllowance
 
 	ip := "0.0.0.0"
 	expire := time.Second * 3
 	allow := 2
 
-	dosguardExpiration = expire
-	dosguardAllowance = allow
+	r.dosguardExpiration = expire
+	r.dosguardAllowance = allow
 
 	// # Use up allowance.
 	for i := 0; i < allow; i++ {
-		if ok, err := r.CheckRegDOSIP(ip); !ok || err != nil {
+		if ok, err := r.CheckRegDOSIP(ctx, ip); !ok || err != nil {
 			t.Fatalf("checkreg step 1 (iter %v) fail: %v, %v", i, ok, err)
 		}
 	}
 	// # Exceed allowance
-	if ok, err := r.CheckRegDOSIP(ip); ok || err != nil {
+	if ok, err := r.CheckRegDOSIP(ctx, ip); ok || err != nil {
 		t.Fatalf("checkreg step 2 fail: %v, %v", ok, err)
 	}
 	// # Wait until ip expires.
 	time.Sleep(expire + 1)
-	if ok, err := r.CheckRegDOSIP(ip); !ok || err != nil {
+	if ok, err := r.CheckRegDOSIP(ctx, ip); !ok || err != nil {
 		t.Fatalf("checkreg step 3 fail: %v, %v", ok, err)
 	}
 	// # Cleanup.
-	dosguardExpiration = dguardExpBackup
-	dosguardAllowance = dguardAllowBackup
+	r.dosguardExpiration = dguardExpBackup
+	r.dosguardAllowance = dguardAllowBackup
+}
+
+func TestCheckRegDOSIPUnavailable(t *testing.T) {
+	// # A closed client fails every command, like an outage.
+	conf := config.Redis{IP: ip, Port: port, PWD: pwd, DB: dbi}
+	closed := New(conf, config.Default().Cache)
+	closed.Close()
+
+	ok, err := closed.CheckRegDOSIP(ctx, "0.0.0.0")
+	if ok || !errors.Is(err, db.ErrUnavailable) {
+		t.Fatalf("expected unavailable, got: %v, %v", ok, err)
+	}
 }
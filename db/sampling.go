@@ -0,0 +1,49 @@
+package db
+
+import (
+	"math/rand"
+	"time"
+)
+
+// SampleOptions are the options of StoredWikiManager.SampleArticles.
+type SampleOptions struct {
+	// Max amount of articles in the sample.
+	Amount int `json:"amount"`
+	// If set, then only articles linked from the article with
+	// this id are sampled ("random neighbour of X").
+	NeighOf *int64 `json:"neighOf,omitempty"`
+	// Only articles with at least this many links to them are
+	// sampled, for picking among well-connected articles.
+	MinInDegree int `json:"minInDegree,omitempty"`
+	// If set, then the same seed gives the same sample, as long
+	// as the graph doesn't change.
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+// Rand returns a source of randomness for sampling, seeded with
+// o.Seed if set, else with the current time.
+func (o SampleOptions) Rand() *rand.Rand {
+	if o.Seed != nil {
+		return rand.New(rand.NewSource(*o.Seed))
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// SampleIDs picks up to <n> of <ids> at random with <rng>, in
+// random order. Given the same ids and rng seed, the pick is the
+// same. <ids> is left as is.
+func SampleIDs(ids []int64, n int, rng *rand.Rand) []int64 {
+	if n > len(ids) {
+		n = len(ids)
+	} else if n < 0 {
+		n = 0
+	}
+	res := make([]int64, len(ids))
+	copy(res, ids)
+	// # Partial Fisher-Yates, only the first n are shuffled in.
+	for i := 0; i < n; i++ {
+		j := i + rng.Intn(len(res)-i)
+		res[i], res[j] = res[j], res[i]
+	}
+	return res[:n]
+}
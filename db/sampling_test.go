@@ -0,0 +1,31 @@
+package db
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSampleIDs(t *testing.T) {
+	ids := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	seed := int64(3)
+	opts := SampleOptions{Seed: &seed}
+	a := SampleIDs(ids, 5, opts.Rand())
+	if len(a) != 5 || !reflect.DeepEqual(a, SampleIDs(ids, 5, opts.Rand())) {
+		t.Fatalf("expected the same sample: %v", a)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Fatalf("ids changed: %v", ids)
+	}
+
+	// # All of them, each once.
+	all := SampleIDs(ids, 100, rand.New(rand.NewSource(1)))
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	if !reflect.DeepEqual(all, ids) {
+		t.Fatalf("expected all ids, got: %v", all)
+	}
+	if res := SampleIDs(nil, 3, opts.Rand()); len(res) != 0 {
+		t.Fatalf("expected none, got: %v", res)
+	}
+}
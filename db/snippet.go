@@ -0,0 +1,156 @@
+package db
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// This file has helpers for building WikiSearchHit snippets,
+// shared by the StoredWikiManager implementations, since the
+// full-text indexes they use only give back scores.
+
+// Tags wrapped around matched terms in snippets.
+const (
+	SnippetMarkOpen  = "<mark>"
+	SnippetMarkClose = "</mark>"
+)
+
+// SnippetWidth is the (rough) amount of runes in
+// snippets made by the StoredWikiManager implementations.
+const SnippetWidth = 200
+
+// Lucene query keywords, which aren't terms.
+var luceneKeywords = map[string]bool{"and": true, "or": true, "not": true}
+
+// SearchTerms extracts lower-case terms from a full-text search
+// query, i.e the words in it, excluding Lucene operators & syntax.
+func SearchTerms(query string) []string {
+	isSep := func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	res := make([]string, 0)
+	for _, term := range strings.FieldsFunc(strings.ToLower(query), isSep) {
+		if !luceneKeywords[term] {
+			res = append(res, term)
+		}
+	}
+	return res
+}
+
+// isWordRune tells if <r> is part of a word, for term boundaries.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// matchAt tells if <term> occurs as a whole word in <lower> at <i>.
+func matchAt(lower []rune, i int, term []rune) bool {
+	if i+len(term) > len(lower) || (i > 0 && isWordRune(lower[i-1])) {
+		return false
+	}
+	for j := range term {
+		if lower[i+j] != term[j] {
+			return false
+		}
+	}
+	end := i + len(term)
+	return end == len(lower) || !isWordRune(lower[end])
+}
+
+// Snippet returns an excerpt of <content> that's at most about <width>
+// runes, around the first occurrence of any term in <query> (see
+// SearchTerms). All term occurrences in the excerpt are wrapped in
+// SnippetMarkOpen & SnippetMarkClose, while everything else is html-
+// escaped, so the result can be used as html. If no term is found,
+// then the excerpt is the start of the content.
+func Snippet(content, query string, width int) string {
+	runes := []rune(content)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	terms := make([][]rune, 0)
+	for _, term := range SearchTerms(query) {
+		terms = append(terms, []rune(term))
+	}
+	// # termAt returns the length of the term found at i, or 0.
+	termAt := func(i int) int {
+		for _, term := range terms {
+			if matchAt(lower, i, term) {
+				return len(term)
+			}
+		}
+		return 0
+	}
+
+	// # Center the excerpt around the first match, if any.
+	start := 0
+	for i := range lower {
+		if termAt(i) > 0 {
+			start = i - width/4
+			break
+		}
+	}
+	// # Near the end, shift back so the full width is used.
+	if start+width > len(runes) {
+		start = len(runes) - width
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	b := strings.Builder{}
+	if start > 0 {
+		b.WriteString("…")
+	}
+	plainFrom := start
+	for i := start; i < end; {
+		n := termAt(i)
+		if n == 0 {
+			i++
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[plainFrom:i])))
+		b.WriteString(SnippetMarkOpen)
+		b.WriteString(html.EscapeString(string(runes[i : i+n])))
+		b.WriteString(SnippetMarkClose)
+		i += n
+		plainFrom = i
+	}
+	if plainFrom < end {
+		b.WriteString(html.EscapeString(string(runes[plainFrom:end])))
+	}
+	// # A match at the edge may have spilled over.
+	if plainFrom > end {
+		end = plainFrom
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// SnippetWindowPad is how many runes before the first match stores
+// should keep when cutting a window of content for SnippetWindow,
+// rather than fetching whole articles. Windows of 3*SnippetWindowPad
+// runes from there are enough for snippets of SnippetWidth.
+const SnippetWindowPad = SnippetWidth
+
+// SnippetWindow is Snippet for a window of a longer content, which
+// starts after <offset> runes of it and is followed by more of it
+// if <more>. Cut off ends are marked with ellipses, as with Snippet.
+func SnippetWindow(window string, offset int, more bool, query string, width int,
+) string {
+	res := Snippet(window, query, width)
+	if offset > 0 && !strings.HasPrefix(res, "…") {
+		res = "…" + res
+	}
+	if more && !strings.HasSuffix(res, "…") {
+		res += "…"
+	}
+	return res
+}
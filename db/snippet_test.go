@@ -0,0 +1,61 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	got := SearchTerms(`"Last Thursday" AND (omphalos OR creation~) -god`)
+	want := "[last thursday omphalos creation god]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("wanted %v, got %v", want, got)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	content := "The <universe> was created last Thursday, or so they say. Thursdays!"
+
+	got := Snippet(content, "thursday", 100)
+	want := "The &lt;universe&gt; was created last <mark>Thursday</mark>, or so they say. Thursdays!"
+	if got != want {
+		t.Fatalf("wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	// # Narrow, so it's cut around the first match.
+	got = Snippet(content, "thursday", 20)
+	want = "…last <mark>Thursday</mark>, or so…"
+	if got != want {
+		t.Fatalf("wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	// # No match, so the start is used.
+	got = Snippet(content, "nope", 9)
+	want = "The &lt;univ…"
+	if got != want {
+		t.Fatalf("wanted:\n%v\ngot:\n%v", want, got)
+	}
+}
+
+func TestSnippetWindow(t *testing.T) {
+	content := strings.Repeat("a ", 500) + "last Thursday" + strings.Repeat(" b", 500)
+	at := strings.Index(content, "Thursday")
+
+	// # Same as a snippet of all the content, as stores cut it.
+	from := at - SnippetWindowPad
+	window := content[from : from+3*SnippetWindowPad]
+	got := SnippetWindow(window, from, true, "thursday", SnippetWidth)
+	if want := Snippet(content, "thursday", SnippetWidth); got != want {
+		t.Fatalf("wanted:\n%v\ngot:\n%v", want, got)
+	}
+
+	// # Cut off ends are marked, even without a match.
+	got = SnippetWindow("b b", 10, true, "thursday", SnippetWidth)
+	if got != "…b b…" {
+		t.Fatalf("unexpected snippet: %v", got)
+	}
+	if got = SnippetWindow("b b", 0, false, "thursday", SnippetWidth); got != "b b" {
+		t.Fatalf("unexpected snippet: %v", got)
+	}
+}
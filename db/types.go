@@ -1,11 +1,168 @@
 package db
 
+import "time"
+
 // WikiData represents a packet of 'normal' data
 // retrieved from the database for normal front-
 // end operations. This does not include the html
 // because that must be fetched separately, as
-// that is relatively rare.
+// that is relatively rare. Fields other than ID
+// and Title are optional, they're only set when
+// asked for (see fields.go).
 type WikiData struct {
 	ID    int64  `json:"id"`
 	Title string `json:"title"`
+
+	// # Lead paragraph, see Summary.
+	Summary string `json:"summary,omitempty"`
+	// # Amount of links from & to the article.
+	OutDegree *int64 `json:"outDegree,omitempty"`
+	InDegree  *int64 `json:"inDegree,omitempty"`
+	// # Sum of lookups of links to the article, i.e how
+	// # often it was navigated to (see IncrementRel).
+	Lookups    *int64   `json:"lookups,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	// # When the article was last added or updated, unset
+	// # for articles added before this was kept track of.
+	Updated *time.Time `json:"updated,omitempty"`
+}
+
+// WikiLookup is the result of looking up many articles by
+// id and title at once, keyed by input. Titles aren't unique,
+// so a title maps to the article with the lowest id among the
+// ones with that title. Inputs without a match are listed in
+// MissingIDs & MissingTitles.
+type WikiLookup struct {
+	ByID          map[int64]*WikiData  `json:"byId"`
+	ByTitle       map[string]*WikiData `json:"byTitle"`
+	MissingIDs    []int64              `json:"missingIds"`
+	MissingTitles []string             `json:"missingTitles"`
+}
+
+// NewWikiLookup returns a WikiLookup of <found> articles, which were
+// looked up by <ids> & <titles>. Found articles which match neither
+// are ignored.
+func NewWikiLookup(ids []int64, titles []string, found []*WikiData) *WikiLookup {
+	res := &WikiLookup{
+		ByID:          make(map[int64]*WikiData),
+		ByTitle:       make(map[string]*WikiData),
+		MissingIDs:    make([]int64, 0),
+		MissingTitles: make([]string, 0),
+	}
+	wantIDs := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wantIDs[id] = true
+	}
+	wantTitles := make(map[string]bool, len(titles))
+	for _, title := range titles {
+		wantTitles[title] = true
+	}
+	for _, d := range found {
+		if wantIDs[d.ID] {
+			res.ByID[d.ID] = d
+		}
+		if other, ok := res.ByTitle[d.Title]; wantTitles[d.Title] &&
+			(!ok || d.ID < other.ID) {
+			res.ByTitle[d.Title] = d
+		}
+	}
+	// # In input order, once each.
+	for _, id := range ids {
+		if _, ok := res.ByID[id]; !ok && wantIDs[id] {
+			res.MissingIDs = append(res.MissingIDs, id)
+			wantIDs[id] = false
+		}
+	}
+	for _, title := range titles {
+		if _, ok := res.ByTitle[title]; !ok && wantTitles[title] {
+			res.MissingTitles = append(res.MissingTitles, title)
+			wantTitles[title] = false
+		}
+	}
+	return res
+}
+
+// Articles returns all distinct articles of the lookup.
+func (l *WikiLookup) Articles() []*WikiData {
+	res := make([]*WikiData, 0, len(l.ByID)+len(l.ByTitle))
+	seen := make(map[*WikiData]bool)
+	for _, d := range l.ByID {
+		if !seen[d] {
+			seen[d] = true
+			res = append(res, d)
+		}
+	}
+	for _, d := range l.ByTitle {
+		if !seen[d] {
+			seen[d] = true
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// WikiSearchHit represents a WikiData found by a full-
+// text search, along with its relevance score and a snippet
+// of the content around the matched terms (see Snippet).
+type WikiSearchHit struct {
+	WikiData
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// WikiGraph represents a part of the article graph, i.e some
+// articles and the HYPERLINKS relationships among them. Each
+// edge is of form [from id, to id, lookups].
+type WikiGraph struct {
+	Nodes []*WikiData `json:"nodes"`
+	Edges [][3]int64  `json:"edges"`
+}
+
+// WikiRelCheck tells if a HYPERLINKS relationship exists,
+// along with its weight (see WikiRel.Lookups), which is 0
+// if it doesn't exist.
+type WikiRelCheck struct {
+	Exists  bool  `json:"exists"`
+	Lookups int64 `json:"lookups"`
+}
+
+// WikiArticle represents a complete article, i.e with
+// content and html. This is what's used when populating
+// a database, as opposed to the slim WikiData which is
+// used for normal front-end operations. ID is the stable
+// id of the article, where 0 means one is made from the
+// title (see StableID). LegacyID is the id the article had
+// before stable ids were introduced, if any. If Summary is
+// empty, then one is made from the content (see Summary).
+type WikiArticle struct {
+	ID         int64    `json:"id,omitempty"`
+	LegacyID   *int64   `json:"legacyId,omitempty"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	HTML       string   `json:"html"`
+	Summary    string   `json:"summary,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// SummaryOrLead returns a.Summary, or the Summary of a.Content
+// if it's empty.
+func (a *WikiArticle) SummaryOrLead() string {
+	if a.Summary != "" {
+		return a.Summary
+	}
+	return Summary(a.Content, SummaryWidth)
+}
+
+// WikiRel represents a HYPERLINKS relationship from one
+// article to another, where the articles are referred to
+// by title. Lookups is the relationship weight maintained
+// by StoredWikiManager.IncrementRel; 0 means unset.
+// FromID & ToID are the article ids, which are only set by
+// StoredWikiIterator.EachRel, since titles aren't unique.
+type WikiRel struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Lookups int64  `json:"lookups,omitempty"`
+	FromID  int64  `json:"-"`
+	ToID    int64  `json:"-"`
 }
@@ -0,0 +1,31 @@
+package dump
+
+import (
+	"wikinodes-server/db"
+)
+
+// This pkg moves whole graphs in and out of a database,
+// using a JSON Lines dump where each line is a record of
+// either of these two forms:
+//
+// 	{"kind":"article","title":"A","content":"...","html":"..."}
+// 	{"kind":"link","from":"A","to":"B","lookups":3}
+//
+// Links refer to articles by title, so they must come
+// after the articles they refer to. Articles may also have
+// an "id" (their stable id, made from the title if left
+// out, see db.StableID) and a "legacyId", both of which
+// are included in exports.
+
+// Record kinds.
+const (
+	kindArticle = "article"
+	kindLink    = "link"
+)
+
+// record is a single line of a JSON Lines dump.
+type record struct {
+	Kind string `json:"kind"`
+	db.WikiArticle
+	db.WikiRel
+}
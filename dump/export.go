@@ -0,0 +1,213 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"wikinodes-server/db"
+)
+
+// Export formats.
+const (
+	FormatJSONL   = "jsonl"
+	FormatGraphML = "graphml"
+	FormatDOT     = "dot"
+)
+
+// ExportStats keeps count of what an export has written.
+type ExportStats struct {
+	Articles int
+	Links    int
+}
+
+// encoder writes a graph in some format. Calls are always
+// made in the order: begin, article..., link..., end.
+type encoder interface {
+	begin() error
+	article(a *db.WikiArticle) error
+	link(r *db.WikiRel) error
+	end() error
+}
+
+// Export walks through all articles and links in <src> and writes
+// them to <w> in the given format (see Format* consts). Only JSONL
+// includes article content & html, so that's the format to use for
+// backups (it's what Import reads), the others are for analysis.
+// <ctx> is passed on to <src>, so cancelling it stops the export.
+func Export(ctx context.Context, w io.Writer, src db.StoredWikiIterator,
+	format string) (ExportStats, error) {
+	stats := ExportStats{}
+	bw := bufio.NewWriter(w)
+
+	var enc encoder
+	switch format {
+	case FormatJSONL:
+		enc = &jsonlEncoder{enc: json.NewEncoder(bw)}
+	case FormatGraphML:
+		enc = &graphmlEncoder{w: bw}
+	case FormatDOT:
+		enc = &dotEncoder{w: bw}
+	default:
+		return stats, fmt.Errorf("unknown export format: '%s'", format)
+	}
+
+	if err := enc.begin(); err != nil {
+		return stats, err
+	}
+	err := src.EachArticle(ctx, format == FormatJSONL, func(a *db.WikiArticle) error {
+		stats.Articles++
+		return enc.article(a)
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = src.EachRel(ctx, func(r *db.WikiRel) error {
+		stats.Links++
+		return enc.link(r)
+	})
+	if err != nil {
+		return stats, err
+	}
+	if err := enc.end(); err != nil {
+		return stats, err
+	}
+	return stats, bw.Flush()
+}
+
+// ExportFile is Export to a file at <path>, where "-" means stdout.
+func ExportFile(ctx context.Context, path string, src db.StoredWikiIterator,
+	format string) (ExportStats, error) {
+	if path == "-" {
+		return Export(ctx, os.Stdout, src, format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return ExportStats{}, err
+	}
+	stats, err := Export(ctx, f, src, format)
+	if err != nil {
+		f.Close()
+		return stats, err
+	}
+	return stats, f.Close()
+}
+
+// ---------------- JSON Lines ------------------ //
+
+// jsonlEncoder writes the dump format described in the pkg doc.
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) begin() error { return nil }
+func (e *jsonlEncoder) end() error   { return nil }
+
+func (e *jsonlEncoder) article(a *db.WikiArticle) error {
+	return e.enc.Encode(struct {
+		Kind string `json:"kind"`
+		*db.WikiArticle
+	}{kindArticle, a})
+}
+
+func (e *jsonlEncoder) link(r *db.WikiRel) error {
+	return e.enc.Encode(struct {
+		Kind string `json:"kind"`
+		*db.WikiRel
+	}{kindLink, r})
+}
+
+// ----------------- GraphML -------------------- //
+
+// graphmlEncoder writes GraphML, where article ids are used as node
+// ids (titles aren't unique), titles & legacy ids are node attributes
+// and the 'lookups' weight is an edge attribute.
+type graphmlEncoder struct {
+	w *bufio.Writer
+}
+
+// xmlEscape escapes <s> for use in XML text and attributes.
+func xmlEscape(s string) string {
+	b := strings.Builder{}
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (e *graphmlEncoder) begin() error {
+	_, err := e.w.WriteString(xml.Header +
+		`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n" +
+		`  <key id="title" for="node" attr.name="title" attr.type="string"/>` + "\n" +
+		`  <key id="legacyId" for="node" attr.name="legacyId" attr.type="long"/>` + "\n" +
+		`  <key id="lookups" for="edge" attr.name="lookups" attr.type="long"/>` + "\n" +
+		`  <graph id="wikinodes" edgedefault="directed">` + "\n")
+	return err
+}
+
+func (e *graphmlEncoder) article(a *db.WikiArticle) error {
+	legacy := ""
+	if a.LegacyID != nil {
+		legacy = fmt.Sprintf("<data key=\"legacyId\">%d</data>", *a.LegacyID)
+	}
+	_, err := fmt.Fprintf(e.w,
+		"    <node id=\"%d\"><data key=\"title\">%s</data>%s</node>\n",
+		a.ID, xmlEscape(a.Title), legacy)
+	return err
+}
+
+func (e *graphmlEncoder) link(r *db.WikiRel) error {
+	_, err := fmt.Fprintf(e.w,
+		"    <edge source=\"%d\" target=\"%d\"><data key=\"lookups\">%d</data></edge>\n",
+		r.FromID, r.ToID, r.Lookups)
+	return err
+}
+
+func (e *graphmlEncoder) end() error {
+	_, err := e.w.WriteString("  </graph>\n</graphml>\n")
+	return err
+}
+
+// --------------- Graphviz DOT ----------------- //
+
+// dotEncoder writes a Graphviz digraph, where article ids are used
+// as node ids (titles aren't unique), titles are node labels, legacy
+// ids are node attributes and the 'lookups' weight is an edge attribute.
+type dotEncoder struct {
+	w *bufio.Writer
+}
+
+// dotQuote quotes <s> as a DOT ID.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func (e *dotEncoder) begin() error {
+	_, err := e.w.WriteString("digraph wikinodes {\n")
+	return err
+}
+
+func (e *dotEncoder) article(a *db.WikiArticle) error {
+	legacy := ""
+	if a.LegacyID != nil {
+		legacy = fmt.Sprintf(", legacyid=%d", *a.LegacyID)
+	}
+	_, err := fmt.Fprintf(e.w, "  %d [label=%s%s];\n",
+		a.ID, dotQuote(a.Title), legacy)
+	return err
+}
+
+func (e *dotEncoder) link(r *db.WikiRel) error {
+	_, err := fmt.Fprintf(e.w, "  %d -> %d [lookups=%d];\n",
+		r.FromID, r.ToID, r.Lookups)
+	return err
+}
+
+func (e *dotEncoder) end() error {
+	_, err := e.w.WriteString("}\n")
+	return err
+}
@@ -0,0 +1,163 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memgraph"
+)
+
+// exportTestGraph returns a small graph: a -> b (lookups 3), a -> c.
+func exportTestGraph() *memgraph.MemGraphManager {
+	m := memgraph.New()
+	a := m.AddArticle("a", "ca", "ha")
+	b := m.AddArticle(`b "<&>"`, "cb", "hb")
+	c := m.AddArticle("c", "cc", "hc")
+	m.AddRel(a, b)
+	m.AddRel(a, c)
+	for i := 0; i < 3; i++ {
+		m.IncrementRel(ctx, a, b)
+	}
+	return m
+}
+
+func TestExportJSONLRoundTrip(t *testing.T) {
+	buf := bytes.Buffer{}
+	stats, err := Export(ctx, &buf, exportTestGraph(), FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Articles != 3 || stats.Links != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	first := buf.String()
+
+	// # Import the dump & export again, should be identical.
+	m := memgraph.New()
+	if _, err := Import(ctx, strings.NewReader(first), m, 10); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if _, err := Export(ctx, &buf, m, FormatJSONL); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != first {
+		t.Fatalf("round trip mismatch:\n%s\nvs\n%s", first, buf.String())
+	}
+	if !strings.Contains(first, `"lookups":3`) {
+		t.Fatal("lookups not exported")
+	}
+}
+
+func TestExportGraphML(t *testing.T) {
+	buf := bytes.Buffer{}
+	if _, err := Export(ctx, &buf, exportTestGraph(), FormatGraphML); err != nil {
+		t.Fatal(err)
+	}
+	// # Check it's valid XML with the expected structure.
+	doc := struct {
+		Graph struct {
+			Nodes []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+				Data   string `xml:"data"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}{}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Graph.Nodes) != 3 || len(doc.Graph.Edges) != 2 {
+		t.Fatalf("unexpected graph: %+v", doc.Graph)
+	}
+	e := doc.Graph.Edges[0]
+	// # Ids are sequential, a is 1 & b is 2.
+	if e.Source != "1" || e.Target != "2" || e.Data != "3" {
+		t.Fatalf("unexpected edge: %+v", e)
+	}
+	if !strings.Contains(buf.String(),
+		`<node id="2"><data key="title">b &#34;&lt;&amp;&gt;&#34;</data></node>`) {
+		t.Fatalf("unexpected nodes:\n%s", buf.String())
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	buf := bytes.Buffer{}
+	if _, err := Export(ctx, &buf, exportTestGraph(), FormatDOT); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`  2 [label="b \"<&>\""];`, `  1 -> 2 [lookups=3];`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected %s in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestExportDuplicateTitles(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "", "")
+	legacy := int64(7)
+	err := m.AddArticles(ctx, []*db.WikiArticle{{Title: "a", LegacyID: &legacy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddRel(a, m.AddArticle("a", "", ""))
+
+	// # Two distinct nodes, linked by id.
+	buf := bytes.Buffer{}
+	if _, err := Export(ctx, &buf, m, FormatGraphML); err != nil {
+		t.Fatal(err)
+	}
+	doc := struct {
+		Graph struct {
+			Nodes []struct {
+				ID   string `xml:"id,attr"`
+				Data []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+				Target string `xml:"target,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}{}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	nodes, edges := doc.Graph.Nodes, doc.Graph.Edges
+	if len(nodes) != 2 || nodes[0].ID != "1" || nodes[1].ID != "2" ||
+		fmt.Sprint(nodes[0].Data) != "[{title a} {legacyId 7}]" ||
+		fmt.Sprint(nodes[1].Data) != "[{title a}]" {
+		t.Fatalf("unexpected nodes: %+v", nodes)
+	}
+	if len(edges) != 1 || edges[0].Source != "1" || edges[0].Target != "2" {
+		t.Fatalf("unexpected edges: %+v", edges)
+	}
+
+	buf.Reset()
+	if _, err := Export(ctx, &buf, m, FormatDOT); err != nil {
+		t.Fatal(err)
+	}
+	want := "digraph wikinodes {\n" +
+		"  1 [label=\"a\", legacyid=7];\n" +
+		"  2 [label=\"a\"];\n" +
+		"  1 -> 2 [lookups=0];\n" +
+		"}\n"
+	if buf.String() != want {
+		t.Fatalf("wanted:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if _, err := Export(ctx, &bytes.Buffer{}, memgraph.New(), "nope"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
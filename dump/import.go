@@ -0,0 +1,136 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"wikinodes-server/db"
+)
+
+// Lines in a dump can be large (article html), this is the
+// max size of a single line accepted by the importer.
+const maxLineSize = 64 * 1024 * 1024
+
+// ImportStats keeps count of what an import has read.
+type ImportStats struct {
+	Articles int
+	Links    int
+}
+
+// importer buffers records and writes them in batches.
+type importer struct {
+	ctx       context.Context
+	w         db.StoredWikiWriter
+	batchSize int
+	articles  []*db.WikiArticle
+	rels      []*db.WikiRel
+	stats     ImportStats
+}
+
+// flushArticles writes all buffered articles.
+func (im *importer) flushArticles() error {
+	if len(im.articles) == 0 {
+		return nil
+	}
+	if err := im.w.AddArticles(im.ctx, im.articles); err != nil {
+		return err
+	}
+	im.articles = im.articles[:0]
+	return nil
+}
+
+// flushRels writes all buffered rels. Buffered articles are
+// written first, since the rels might refer to them.
+func (im *importer) flushRels() error {
+	if err := im.flushArticles(); err != nil {
+		return err
+	}
+	if len(im.rels) == 0 {
+		return nil
+	}
+	if err := im.w.AddRels(im.ctx, im.rels); err != nil {
+		return err
+	}
+	im.rels = im.rels[:0]
+	return nil
+}
+
+// add buffers a record, flushing if the batch is full.
+func (im *importer) add(rec *record) error {
+	switch rec.Kind {
+	case kindArticle:
+		a := rec.WikiArticle
+		im.articles = append(im.articles, &a)
+		im.stats.Articles++
+		if len(im.articles) >= im.batchSize {
+			return im.flushArticles()
+		}
+	case kindLink:
+		r := rec.WikiRel
+		im.rels = append(im.rels, &r)
+		im.stats.Links++
+		if len(im.rels) >= im.batchSize {
+			return im.flushRels()
+		}
+	default:
+		return fmt.Errorf("unknown record kind: '%s'", rec.Kind)
+	}
+	return nil
+}
+
+// Import reads a JSON Lines dump (see pkg doc) from <r> and writes
+// it into <w>, <batchSize> articles or links at a time. The returned
+// stats tell how many records were read, also when an error occurs.
+// <ctx> is passed on to <w>, so cancelling it stops the import.
+func Import(ctx context.Context, r io.Reader, w db.StoredWikiWriter,
+	batchSize int) (ImportStats, error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	im := importer{
+		ctx:       ctx,
+		w:         w,
+		batchSize: batchSize,
+		articles:  make([]*db.WikiArticle, 0, batchSize),
+		rels:      make([]*db.WikiRel, 0, batchSize),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		b := scanner.Bytes()
+		// # Allow blank lines, such as a trailing one.
+		if len(b) == 0 {
+			continue
+		}
+		rec := record{}
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return im.stats, fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := im.add(&rec); err != nil {
+			return im.stats, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return im.stats, err
+	}
+	// # flushRels flushes articles as well.
+	return im.stats, im.flushRels()
+}
+
+// ImportFile is Import for a file at <path>, where "-" means stdin.
+func ImportFile(ctx context.Context, path string, w db.StoredWikiWriter,
+	batchSize int) (ImportStats, error) {
+	if path == "-" {
+		return Import(ctx, os.Stdin, w, batchSize)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer f.Close()
+	return Import(ctx, f, w, batchSize)
+}
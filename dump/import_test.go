@@ -0,0 +1,95 @@
+package dump
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memgraph"
+)
+
+var ctx = context.Background()
+
+// countingWriter wraps a db.StoredWikiWriter and counts calls.
+type countingWriter struct {
+	db.StoredWikiWriter
+	articleCalls int
+	relCalls     int
+}
+
+func (c *countingWriter) AddArticles(
+	ctx context.Context, articles []*db.WikiArticle) error {
+	c.articleCalls++
+	return c.StoredWikiWriter.AddArticles(ctx, articles)
+}
+
+func (c *countingWriter) AddRels(ctx context.Context, rels []*db.WikiRel) error {
+	c.relCalls++
+	return c.StoredWikiWriter.AddRels(ctx, rels)
+}
+
+func TestImport(t *testing.T) {
+	dump := `
+{"kind":"article","title":"a","content":"ca","html":"ha"}
+{"kind":"article","title":"b","content":"cb","html":"hb"}
+{"kind":"article","title":"c","content":"cc","html":"hc"}
+{"kind":"link","from":"a","to":"b","lookups":5}
+{"kind":"link","from":"a","to":"c"}
+{"kind":"link","from":"a","to":"nope"}
+`
+	m := memgraph.New()
+	w := &countingWriter{StoredWikiWriter: m}
+	stats, err := Import(ctx, strings.NewReader(dump), w, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Articles != 3 || stats.Links != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	// # 3 articles in batches of 2 -> 2 calls, same for links.
+	if w.articleCalls != 2 || w.relCalls != 2 {
+		t.Fatalf("unexpected batching: %v, %v", w.articleCalls, w.relCalls)
+	}
+
+	a, _ := m.SearchArticlesByTitle(ctx, "a", 0, 10)
+	b, _ := m.SearchArticlesByTitle(ctx, "b", 0, 10)
+	c, _ := m.SearchArticlesByTitle(ctx, "c", 0, 10)
+	if len(a) != 1 || len(b) != 1 || len(c) != 1 {
+		t.Fatal("articles not imported")
+	}
+	html, _ := m.SearchArticlesHTMLByID(ctx, b[0].ID)
+	if html != "hb" {
+		t.Fatal("unexpected html: ", html)
+	}
+	rels, _ := m.CheckRelsExistByIDs(ctx,
+		[][2]int64{{a[0].ID, b[0].ID}, {a[0].ID, c[0].ID}, {b[0].ID, a[0].ID}})
+	if !rels[0] || !rels[1] || rels[2] {
+		t.Fatalf("unexpected rels: %v", rels)
+	}
+}
+
+func TestImportIDs(t *testing.T) {
+	dump := `
+{"kind":"article","title":"a"}
+{"kind":"article","id":42,"legacyId":7,"title":"b"}
+`
+	m := memgraph.New()
+	if _, err := Import(ctx, strings.NewReader(dump), m, 10); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := m.SearchArticlesByTitle(ctx, "a", 0, 10)
+	b, _ := m.SearchArticlesByLegacyID(ctx, 7)
+	if len(a) != 1 || a[0].ID != db.StableID("a") || len(b) != 1 || b[0].ID != 42 {
+		t.Fatalf("unexpected ids: %v, %v", a, b)
+	}
+}
+
+func TestImportBadRecord(t *testing.T) {
+	dump := `{"kind":"article","title":"a"}
+{"kind":"nope"}
+`
+	_, err := Import(ctx, strings.NewReader(dump), memgraph.New(), 10)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2") {
+		t.Fatal("expected error on line 2, got: ", err)
+	}
+}
@@ -5,4 +5,5 @@ go 1.14
 require (
 	github.com/go-redis/redis/v8 v8.7.1
 	github.com/neo4j/neo4j-go-driver v1.8.3
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -1,25 +1,269 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
 	"wikinodes-server/db/neo4j"
 	"wikinodes-server/db/redis"
+	"wikinodes-server/dump"
 	"wikinodes-server/wapi"
 )
 
 func main() {
+	conf, opts, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	// # Print before failing on validation, as the printed
+	// # config is a good tool for finding out what's wrong.
+	if opts != nil && opts.PrintConfig {
+		if err := conf.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.PrintConfig {
+		return
+	}
+
+	// # Subcommands.
+	if len(opts.Args) > 0 {
+		switch opts.Args[0] {
+		case "import":
+			runImport(conf, opts.Args[1:])
+			return
+		case "export":
+			runExport(conf, opts.Args[1:])
+			return
+		case "migrate-ids":
+			runMigrateIDs(conf, opts.Args[1:])
+			return
+		}
+		log.Fatalf("unknown subcommand: '%s'", opts.Args[0])
+	}
 
-	r := redis.New(config.RedisIP, config.RedisPort, config.RedisPWD, config.RedisDB)
-	n, err := neo4j.New(config.Neo4jURI, config.Neo4jUSR, config.Neo4jPWD)
+	serve(conf)
+}
+
+// serve runs the server until SIGINT/SIGTERM, at which point
+// in-flight requests are drained (within conf.WAPI.ShutdownTimeout)
+// before the store and cache are closed.
+func serve(conf *config.Config) {
+	r, err := newCache(conf)
 	if err != nil {
-		msg := fmt.Sprint("neo4j setup err:", err)
-		log.Fatal(msg)
+		log.Fatal(err)
+	}
+	defer r.Close()
+	n, err := newStore(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer n.Close()
+
+	server := wapi.New(conf.WAPI, n, r)
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-errs:
+		// # Failed to start, e.g port in use. No log.Fatal,
+		// # so the deferred closing still happens.
+		log.Print(err)
+		return
+	case s := <-sig:
+		log.Printf("got %v, shutting down", s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.WAPI.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("shutdown err (requests may have been cut): %v", err)
+	}
+}
+
+// runImport is the 'import' subcommand, which loads a JSON Lines
+// dump (see pkg dump) into the store specified by <conf>.
+// Usage:
+// 	wikinodes-server [config flags] import [-batch n] <file|->
+func runImport(conf *config.Config, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	batch := fs.Int("batch", conf.Import.BatchSize, "articles/links per batch")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: wikinodes-server import [-batch n] <file|->")
 	}
 
-	if err = wapi.Start(n, r); err != nil {
+	n, err := newStore(conf)
+	if err != nil {
 		log.Fatal(err)
 	}
+	defer n.Close()
+	w, ok := n.(db.StoredWikiWriter)
+	if !ok {
+		log.Fatalf("store backend '%s' can't be written to", conf.Store.Backend)
+	}
+	// # Ctrl-C stops the import between batches.
+	ctx, cancel := signalContext()
+	defer cancel()
+	if s, ok := n.(schemaEnsurer); ok {
+		if err := s.EnsureSchema(ctx); err != nil {
+			log.Fatalf("schema err: %v", err)
+		}
+	}
+	stats, err := dump.ImportFile(ctx, fs.Arg(0), w, *batch)
+	if err != nil {
+		log.Fatalf("import err (after %d articles, %d links): %v",
+			stats.Articles, stats.Links, err)
+	}
+	fmt.Printf("imported %d articles, %d links\n", stats.Articles, stats.Links)
+}
+
+// schemaEnsurer is implemented by stores which need a schema,
+// such as the uniqueness of stable ids, see neo4j.EnsureSchema.
+type schemaEnsurer interface {
+	EnsureSchema(ctx context.Context) error
+}
 
+// runMigrateIDs is the 'migrate-ids' subcommand, which gives stable
+// ids to articles of a neo4j store built before they existed, keeping
+// the old (internal) ids as legacy ids, see neo4j.MigrateIDs. Set
+// wapi.legacy_ids afterwards to keep resolving old links.
+// Usage:
+// 	wikinodes-server [config flags] migrate-ids [-batch n]
+func runMigrateIDs(conf *config.Config, args []string) {
+	fs := flag.NewFlagSet("migrate-ids", flag.ExitOnError)
+	batch := fs.Int("batch", conf.Import.BatchSize, "articles per batch")
+	fs.Parse(args)
+	if fs.NArg() != 0 || *batch <= 0 {
+		log.Fatal("usage: wikinodes-server migrate-ids [-batch n]")
+	}
+	if conf.Store.Backend != "neo4j" {
+		log.Fatalf("store backend '%s' has nothing to migrate", conf.Store.Backend)
+	}
+
+	n, err := neo4j.New(conf.Neo4j)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer n.Close()
+	// # Ctrl-C stops the migration between batches,
+	// # it can be resumed by running it again.
+	ctx, cancel := signalContext()
+	defer cancel()
+	stats, err := n.MigrateIDs(ctx, *batch)
+	for _, id := range stats.Untitled {
+		log.Printf("skipped article %d: no title", id)
+	}
+	for _, id := range stats.Collisions {
+		log.Printf("skipped article %d: its stable id is taken", id)
+	}
+	if err != nil {
+		log.Fatalf("migration err (after %d articles, %d skipped): %v",
+			stats.Migrated, stats.Skipped(), err)
+	}
+	// # After migrating, as existing duplicates would fail it.
+	if err := n.EnsureSchema(ctx); err != nil {
+		log.Fatalf("schema err: %v", err)
+	}
+	fmt.Printf("migrated %d articles\n", stats.Migrated)
+}
+
+// runExport is the 'export' subcommand, which writes all articles
+// and links of the store specified by <conf> in a given format.
+// Usage:
+// 	wikinodes-server [config flags] export [-format jsonl|graphml|dot] <file|->
+func runExport(conf *config.Config, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", dump.FormatJSONL, "jsonl, graphml or dot")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: wikinodes-server export [-format jsonl|graphml|dot] <file|->")
+	}
+
+	n, err := newStore(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer n.Close()
+	src, ok := n.(db.StoredWikiIterator)
+	if !ok {
+		log.Fatalf("store backend '%s' can't be iterated", conf.Store.Backend)
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	stats, err := dump.ExportFile(ctx, fs.Arg(0), src, *format)
+	if err != nil {
+		log.Fatalf("export err (after %d articles, %d links): %v",
+			stats.Articles, stats.Links, err)
+	}
+	// # Stderr, so stdout can be used for the export itself.
+	fmt.Fprintf(os.Stderr,
+		"exported %d articles, %d links\n", stats.Articles, stats.Links)
+}
+
+// signalContext returns a context that is cancelled on SIGINT/SIGTERM,
+// for subcommands which should stop talking to the store when told to.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+	}()
+	return ctx, cancel
+}
+
+// newStore sets up the db.StoredWikiManager specified
+// by conf.Store.Backend.
+func newStore(conf *config.Config) (db.StoredWikiManager, error) {
+	switch conf.Store.Backend {
+	case "neo4j":
+		n, err := neo4j.New(conf.Neo4j)
+		if err != nil {
+			return nil, fmt.Errorf("neo4j setup err: %v", err)
+		}
+		return n, nil
+	case "memory":
+		m := memgraph.New()
+		if conf.Store.MemorySeed == "" {
+			return m, nil
+		}
+		_, err := dump.ImportFile(context.Background(),
+			conf.Store.MemorySeed, m, conf.Import.BatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("memory store seed err: %v", err)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown store backend: '%s'", conf.Store.Backend)
+}
+
+// newCache sets up the db.CacheManager specified
+// by conf.Cache.Backend.
+func newCache(conf *config.Config) (db.CacheManager, error) {
+	switch conf.Cache.Backend {
+	case "redis":
+		return redis.New(conf.Redis, conf.Cache), nil
+	case "memory":
+		return memcache.New(conf.Cache), nil
+	}
+	return nil, fmt.Errorf("unknown cache backend: '%s'", conf.Cache.Backend)
 }
@@ -0,0 +1,122 @@
+package wapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"wikinodes-server/db"
+)
+
+// Error responses are JSON of form
+// 	{"error":{"code":string, "message":string, "requestId":string}}
+// where code is one of the err* consts below, meant for clients to
+// act on, while message is meant for humans. requestId is also sent
+// in the X-Request-Id header of all responses, and is included in
+// the server log along with the underlying error.
+
+// Error codes.
+const (
+	errBadRequest       = "bad_request"         // # 400, invalid options.
+	errNotFound         = "not_found"           // # 404, no such article/endpoint.
+	errMethodNotAllowed = "method_not_allowed"  // # 405, see router.
+	errTooLarge         = "too_large"           // # 413, request body too big.
+	errRateLimited      = "rate_limited"        // # 429, see midDOS.
+	errInternal         = "internal"            // # 500, a bug or db error.
+	errUnavailable      = "backend_unavailable" // # 503, db/cache is down.
+	errTimeout          = "timeout"             // # 504, see midTimeout.
+)
+
+// headerRequestID is the header with the request id, which
+// clients can set themselves (e.g to correlate with their
+// own logs), else it's generated, see midRequestID.
+const headerRequestID = "X-Request-Id"
+
+// Max length of client-provided request ids.
+const requestIDMaxLen = 64
+
+// apiError is the body of error responses.
+type apiError struct {
+	Error struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"requestId"`
+	} `json:"error"`
+}
+
+// newRequestID returns a random request id.
+func newRequestID() string {
+	b := make([]byte, 8)
+	// # Never fails in practice, and a zero id is still usable.
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID tells if a client-provided request id is short
+// and plain enough to be echoed back and logged.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLen {
+		return false
+	}
+	for _, c := range id {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sendError sends an error response, where <err> is the underlying
+// error (if any) which is logged but not sent. The request id is
+// read from the response header, as set by midRequestID.
+func (h *handler) sendError(w http.ResponseWriter,
+	status int, code, message string, err error,
+) {
+	res := apiError{}
+	res.Error.Code = code
+	res.Error.Message = message
+	res.Error.RequestID = w.Header().Get(headerRequestID)
+	if err != nil {
+		log.Printf("request %s: %s: %s: %v", res.Error.RequestID, code, message, err)
+	}
+
+	b, _ := json.Marshal(res) // # Can't fail, only strings.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// sendBadRequest sends an errBadRequest response, where <message>
+// tells what's wrong with the request.
+func (h *handler) sendBadRequest(w http.ResponseWriter, message string) {
+	h.sendError(w, http.StatusBadRequest, errBadRequest, message, nil)
+}
+
+// sendNotFound sends an errNotFound response.
+func (h *handler) sendNotFound(w http.ResponseWriter, message string) {
+	h.sendError(w, http.StatusNotFound, errNotFound, message, nil)
+}
+
+// sendBackendError sends an error response for an error returned
+// by the db or cache, picking the code based on what went wrong.
+func (h *handler) sendBackendError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrUnavailable):
+		h.sendError(w, http.StatusServiceUnavailable, errUnavailable,
+			"database unavailable, try again later", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		h.sendError(w, http.StatusGatewayTimeout, errTimeout,
+			"request took too long", err)
+	case errors.Is(err, context.Canceled):
+		// # Client is gone, nobody to respond to.
+		log.Printf("request %s: cancelled: %v", w.Header().Get(headerRequestID), err)
+	default:
+		h.sendError(w, http.StatusInternalServerError, errInternal,
+			"internal error", err)
+	}
+}
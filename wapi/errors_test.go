@@ -0,0 +1,170 @@
+package wapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+// failingStore fails SearchArticlesByID with err.
+type failingStore struct {
+	*memgraph.MemGraphManager
+	err error
+}
+
+func (s failingStore) SearchArticlesByID(
+	ctx context.Context, id int64) ([]*db.WikiData, error) {
+	return nil, s.err
+}
+
+// serveTest sends a request with <body> to <path> through all the
+// routes (and middleware) of <h>.
+func serveTest(h *handler, path, body string, header http.Header,
+) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// unpackAPIError unpacks an error response, checking that it's
+// consistent with the response header.
+func unpackAPIError(t *testing.T, rec *httptest.ResponseRecorder) apiError {
+	res := apiError{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("not an error envelope: %v, %s", err, rec.Body.String())
+	}
+	if id := rec.Header().Get(headerRequestID); id != res.Error.RequestID || id == "" {
+		t.Fatalf("request id mismatch: '%s' vs '%s'", id, res.Error.RequestID)
+	}
+	return res
+}
+
+func TestErrorResponses(t *testing.T) {
+	m := memgraph.New()
+	id := m.AddArticle("a", "", "")
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	cases := []struct {
+		path, body string
+		status     int
+		code       string
+	}{
+		{"/data/search/articles/byid", `{"id":`, 400, errBadRequest},
+		{"/data/search/articles/bytitle", `{"cursor":"nope"}`, 400, errBadRequest},
+		{"/data/search/html/byid", `{"id":12345}`, 404, errNotFound},
+		{"/data/search/path", fmt.Sprintf(`{"from":%d, "to":12345}`, id), 404, errNotFound},
+		{"/data/search/subgraph", `{"id":12345}`, 404, errNotFound},
+		{"/data/random/articles", `{"neighOf":12345}`, 404, errNotFound},
+	}
+	for _, c := range cases {
+		rec := serveTest(h, c.path, c.body, nil)
+		if rec.Code != c.status {
+			t.Fatalf("%s %s: wanted status %d, got %d", c.path, c.body, c.status, rec.Code)
+		}
+		if res := unpackAPIError(t, rec); res.Error.Code != c.code {
+			t.Fatalf("%s %s: wanted code %s, got %+v", c.path, c.body, c.code, res)
+		}
+	}
+
+	// # Existing article without html isn't an error.
+	rec := serveTest(h, "/data/search/html/byid", fmt.Sprintf(`{"id":%d}`, id), nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != `""` {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBackendErrorResponses(t *testing.T) {
+	conf := config.Default()
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("%w: conn refused", db.ErrUnavailable), 503, errUnavailable},
+		{context.DeadlineExceeded, 504, errTimeout},
+		{fmt.Errorf("syntax error"), 500, errInternal},
+	}
+	for _, c := range cases {
+		h := &handler{
+			db:    failingStore{memgraph.New(), c.err},
+			cache: memcache.New(conf.Cache),
+			conf:  conf.WAPI,
+		}
+		rec := serveTest(h, "/data/search/articles/byid", `{"id":1}`, nil)
+		if rec.Code != c.status {
+			t.Fatalf("%v: wanted status %d, got %d", c.err, c.status, rec.Code)
+		}
+		res := unpackAPIError(t, rec)
+		if res.Error.Code != c.code {
+			t.Fatalf("%v: wanted code %s, got %+v", c.err, c.code, res)
+		}
+		// # Underlying errors are for the log only.
+		if strings.Contains(rec.Body.String(), c.err.Error()) {
+			t.Fatalf("underlying err leaked: %s", rec.Body.String())
+		}
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	conf := config.Default()
+	conf.Cache.DOSGuardAllowancePerRefresh = 1
+	h := &handler{db: memgraph.New(), cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	serveTest(h, "/data/random/articles", `{}`, nil)
+	rec := serveTest(h, "/data/random/articles", `{}`, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("wanted status 429, got %d", rec.Code)
+	}
+	if res := unpackAPIError(t, rec); res.Error.Code != errRateLimited {
+		t.Fatalf("unexpected code: %+v", res)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	conf := config.Default()
+	h := &handler{db: memgraph.New(), cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	// # Client ids are echoed, unless they're odd.
+	header := http.Header{headerRequestID: []string{"abc-123"}}
+	rec := serveTest(h, "/data/search/articles/byid", `{`, header)
+	if res := unpackAPIError(t, rec); res.Error.RequestID != "abc-123" {
+		t.Fatalf("client request id not used: %+v", res)
+	}
+	header = http.Header{headerRequestID: []string{"abc\n123"}}
+	rec = serveTest(h, "/data/search/articles/byid", `{`, header)
+	if res := unpackAPIError(t, rec); res.Error.RequestID == "abc\n123" {
+		t.Fatalf("odd client request id used: %+v", res)
+	}
+	// # Also set on success.
+	rec = serveTest(h, "/data/random/articles", `{}`, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(headerRequestID) == "" {
+		t.Fatalf("unexpected response: %d, %v", rec.Code, rec.Header())
+	}
+}
+
+func TestTrySendWikiDataMarshalErr(t *testing.T) {
+	h := &handler{}
+	rec := httptest.NewRecorder()
+	rec.Header().Set(headerRequestID, "x") // # As by midRequestID.
+	h.trySendWikiData(rec, math.NaN(), nil)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("wanted status 500, got %d", rec.Code)
+	}
+	if res := unpackAPIError(t, rec); res.Error.Code != errInternal {
+		t.Fatalf("unexpected code: %+v", res)
+	}
+}
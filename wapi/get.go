@@ -0,0 +1,215 @@
+package wapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GET endpoints mirror some of the POST ones, with options in the path
+// and query string instead of a JSON body. Responses are the same, but
+// come with caching headers (ETag & Cache-Control), and
+// conditional requests (If-None-Match) are answered with 304 Not
+// Modified. The POST endpoints are kept as they are, for compatibility.
+
+// trySendCacheable is trySendWikiData for GET endpoints. The ETag is
+// a hash of the response body, so it changes along with the data.
+// There's no Last-Modified, since data changes while the server runs
+// (lookups, imports) without a time that covers all of a response;
+// If-Modified-Since is thus ignored. <maxAge> is how long clients may
+// reuse the response without revalidating it.
+func (h *handler) trySendCacheable(w http.ResponseWriter, r *http.Request,
+	data interface{}, maxAge time.Duration, fetcherr error,
+) {
+	if fetcherr != nil {
+		h.sendBackendError(w, fetcherr)
+		return
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, errInternal,
+			"internal error", err)
+		return
+	}
+	sum := sha256.Sum256(b)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control",
+		fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	// # Handles If-None-Match (and HEAD, Range). A zero modtime
+	// # leaves out Last-Modified & If-Modified-Since checks.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(b))
+}
+
+// tryQueryInt gets the optional int query parameter <name> from <q>,
+// which is 0 if left out. If it isn't an int, then a bad request
+// response is sent and false is returned.
+func (h *handler) tryQueryInt(w http.ResponseWriter, q url.Values, name string,
+) (int, bool) {
+	s := q.Get(name)
+	if s == "" {
+		return 0, true
+	}
+	x, err := strconv.Atoi(s)
+	if err != nil {
+		h.sendBadRequest(w, fmt.Sprintf("%s must be an int, not '%s'", name, s))
+		return 0, false
+	}
+	return x, true
+}
+
+// queryFields gets the optional fields query parameter from <q>, which
+// is a comma-separated list such as "summary,inDegree" (see withFields).
+// It still needs to be validated.
+func queryFields(q url.Values) []string {
+	s := q.Get("fields")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// tryPathID gets the article id from the {id} path param. If it isn't
+// a valid id, then a bad request response is sent and false is returned.
+func (h *handler) tryPathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	s := pathParam(r, "id")
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		h.sendBadRequest(w, fmt.Sprintf("invalid article id '%s'", s))
+		return 0, false
+	}
+	v := optionsValidator{}
+	v.id("id", id)
+	return id, h.tryValidate(w, &v)
+}
+
+// getArticle endpoint serves GET /api/v1/articles/{id}, responding with
+// the article with that id (a single object, unlike byid). A not_found
+// error is sent if there is no such article. The fields query parameter
+// is optional, see queryFields.
+// Curl example:
+// 	curl http://ip:port/api/v1/articles/4279?fields=summary
+func (h *handler) getArticle(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.tryPathID(w, r)
+	if !ok {
+		return
+	}
+	fields := queryFields(r.URL.Query())
+	v := optionsValidator{}
+	v.fields("fields", fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search.
+	res, err := h.db.SearchArticlesByID(r.Context(), id)
+	err = h.withFields(r.Context(), res, fields, err)
+	if err != nil {
+		h.sendBackendError(w, err)
+		return
+	}
+	if len(res) == 0 {
+		h.sendNotFound(w, fmt.Sprintf("no article with id %d", id))
+		return
+	}
+	// # Try response.
+	h.trySendCacheable(w, r, res[0], h.conf.CacheMaxAge, nil)
+}
+
+// getArticleHTML endpoint serves GET /api/v1/articles/{id}/html,
+// responding with the HTML content of the article with that id (as a
+// JSON string). A not_found error is sent if there is no such article.
+// Curl example:
+// 	curl http://ip:port/api/v1/articles/4279/html
+func (h *handler) getArticleHTML(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.tryPathID(w, r)
+	if !ok {
+		return
+	}
+	// # Try db search.
+	res, err := h.db.SearchArticlesHTMLByID(r.Context(), id)
+	// # Empty html might be a missing article.
+	if err == nil && res == "" && !h.tryCheckArticlesExist(w, r, id) {
+		return
+	}
+	// # Try response.
+	h.trySendCacheable(w, r, res, h.conf.HTMLCacheMaxAge, err)
+}
+
+// getLegacyArticle endpoint serves GET /api/v1/legacy/articles/{id},
+// responding with the article which had that (internal) id before
+// stable ids, so old links can be redirected. The article comes with
+// its stable id. A not_found error is sent if there is no such article,
+// or if legacy ids aren't enabled (see config wapi.legacy_ids).
+// Curl example:
+// 	curl http://ip:port/api/v1/legacy/articles/4279
+func (h *handler) getLegacyArticle(w http.ResponseWriter, r *http.Request) {
+	if !h.conf.LegacyIDs {
+		h.sendNotFound(w, "legacy ids are not enabled")
+		return
+	}
+	id, ok := h.tryPathID(w, r)
+	if !ok {
+		return
+	}
+	// # Try db search.
+	res, err := h.db.SearchArticlesByLegacyID(r.Context(), id)
+	if err != nil {
+		h.sendBackendError(w, err)
+		return
+	}
+	if len(res) == 0 {
+		h.sendNotFound(w, fmt.Sprintf("no article with legacy id %d", id))
+		return
+	}
+	// # Try response.
+	h.trySendCacheable(w, r, res[0], h.conf.CacheMaxAge, nil)
+}
+
+// getArticles endpoint serves GET /api/v1/articles?title=string, which
+// is the same as the bytitle endpoint. The limit, cursor and fields
+// query parameters are optional, see pagination.go and queryFields.
+// Unknown query parameters are ignored, as caches and proxies may add
+// their own.
+// Curl example:
+// 	curl "http://ip:port/api/v1/articles?title=Art&limit=5"
+func (h *handler) getArticles(w http.ResponseWriter, r *http.Request) {
+	// # Try get query options.
+	q := r.URL.Query()
+	title := q.Get("title")
+	limit, ok := h.tryQueryInt(w, q, "limit")
+	if !ok {
+		return
+	}
+	var cursor *string
+	if _, ok := q["cursor"]; ok {
+		c := q.Get("cursor")
+		cursor = &c
+	}
+	offset, ok := h.tryDecodeCursor(w, cursor)
+	if !ok {
+		return
+	}
+	fields := queryFields(q)
+	v := optionsValidator{}
+	v.str("title", title, h.conf.StrMaxLen, true)
+	v.limit("limit", &limit, h.conf.PageLimitDefault, h.conf.PageLimitMax)
+	v.fields("fields", fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search, +1 to see if there's a next page.
+	res, err := h.db.SearchArticlesByTitle(r.Context(), title, offset, limit+1)
+	res, more := trimPage(res, limit)
+	err = h.withFields(r.Context(), res, fields, err)
+	// # Try response.
+	h.trySendCacheable(w, r, pageOf(cursor, res, len(res), offset, more),
+		h.conf.CacheMaxAge, err)
+}
@@ -0,0 +1,216 @@
+package wapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+// serveGetTest sends a GET request to <path> through all the routes
+// (and middleware) of <h>.
+func serveGetTest(h *handler, path string, header http.Header,
+) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetArticle(t *testing.T) {
+	m := memgraph.New()
+	id := m.AddArticle("a", "", "<p>a</p>")
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	rec := serveGetTest(h, fmt.Sprintf("/api/v1/articles/%d", id), nil)
+	res := db.WikiData{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unexpected body: %v, %s", err, rec.Body.String())
+	}
+	if rec.Code != http.StatusOK || res.ID != id || res.Title != "a" {
+		t.Fatalf("unexpected response: %d, %+v", rec.Code, res)
+	}
+	for _, k := range []string{"ETag", "Cache-Control"} {
+		if rec.Header().Get(k) == "" {
+			t.Fatalf("missing header %s: %v", k, rec.Header())
+		}
+	}
+	if lm := rec.Header().Get("Last-Modified"); lm != "" {
+		t.Fatalf("unexpected Last-Modified: %s", lm)
+	}
+
+	// # Same data, same ETag; 304 when the client has it.
+	etag := rec.Header().Get("ETag")
+	rec = serveGetTest(h, fmt.Sprintf("/api/v1/articles/%d", id),
+		http.Header{"If-None-Match": []string{etag}})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("wanted 304, got %d, %s", rec.Code, rec.Body.String())
+	}
+	// # Data changes while running, so dates can't be trusted.
+	since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	rec = serveGetTest(h, fmt.Sprintf("/api/v1/articles/%d", id),
+		http.Header{"If-Modified-Since": []string{since}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("wanted 200, got %d", rec.Code)
+	}
+
+	// # HTML has its own max-age.
+	rec = serveGetTest(h, fmt.Sprintf("/api/v1/articles/%d/html", id), nil)
+	html := ""
+	json.Unmarshal(rec.Body.Bytes(), &html)
+	if rec.Code != http.StatusOK || html != "<p>a</p>" {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Fatalf("unexpected Cache-Control: %s", cc)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Fatal("expected a different ETag for different data")
+	}
+}
+
+func TestGetArticleErrors(t *testing.T) {
+	m := memgraph.New()
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	cases := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/api/v1/articles/12345", 404, errNotFound},
+		{"/api/v1/articles/12345/html", 404, errNotFound},
+		{"/api/v1/articles/1/nope", 404, errNotFound},
+		{"/api/v1/articles/abc", 400, errBadRequest},
+		{"/api/v1/articles/-1", 400, errBadRequest},
+		{"/api/v1/articles", 400, errBadRequest},
+		{"/api/v1/articles?title=a&limit=x", 400, errBadRequest},
+		{"/api/v1/articles?title=a&cursor=nope", 400, errBadRequest},
+	}
+	for _, c := range cases {
+		rec := serveGetTest(h, c.path, nil)
+		if rec.Code != c.status {
+			t.Fatalf("%s: wanted status %d, got %d", c.path, c.status, rec.Code)
+		}
+		if res := unpackAPIError(t, rec); res.Error.Code != c.code {
+			t.Fatalf("%s: wanted code %s, got %+v", c.path, c.code, res)
+		}
+		// # Errors aren't cached.
+		if rec.Header().Get("Cache-Control") != "" || rec.Header().Get("ETag") != "" {
+			t.Fatalf("%s: unexpected caching headers: %v", c.path, rec.Header())
+		}
+	}
+}
+
+func TestGetArticlesByTitle(t *testing.T) {
+	m := memgraph.New()
+	for i := 0; i < 3; i++ {
+		m.AddArticle("a", "", "")
+	}
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	rec := serveGetTest(h, "/api/v1/articles?title=a&limit=2", nil)
+	res := []*db.WikiData{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || len(res) != 2 {
+		t.Fatalf("unexpected response: %v, %s", err, rec.Body.String())
+	}
+
+	// # Pages like the POST variant.
+	rec = serveGetTest(h, "/api/v1/articles?title=a&limit=2&cursor=", nil)
+	p := struct {
+		Items      []*db.WikiData `json:"items"`
+		NextCursor string         `json:"nextCursor"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Items) != 2 || p.NextCursor == "" {
+		t.Fatalf("unexpected page: %s", rec.Body.String())
+	}
+	rec = serveGetTest(h, "/api/v1/articles?title=a&limit=2&cursor="+p.NextCursor, nil)
+	p.NextCursor = ""
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Items) != 1 || p.NextCursor != "" {
+		t.Fatalf("unexpected last page: %s", rec.Body.String())
+	}
+}
+
+func TestGetLegacyArticle(t *testing.T) {
+	m := memgraph.New()
+	legacy := int64(7)
+	m.AddArticles(context.Background(),
+		[]*db.WikiArticle{{LegacyID: &legacy, Title: "a"}})
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	// # Disabled by default.
+	rec := serveGetTest(h, "/api/v1/legacy/articles/7", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("wanted 404, got %d", rec.Code)
+	}
+
+	h.conf.LegacyIDs = true
+	rec = serveGetTest(h, "/api/v1/legacy/articles/7", nil)
+	res := db.WikiData{}
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if rec.Code != http.StatusOK || res.ID != db.StableID("a") || res.Title != "a" {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+	rec = serveGetTest(h, "/api/v1/legacy/articles/8", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("wanted 404, got %d", rec.Code)
+	}
+}
+
+func TestArticleFields(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "Lead of a.\nMore.", "")
+	b := m.AddArticle("b", "", "")
+	m.AddRel(a, b)
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	// # Only id & title by default.
+	rec := serveGetTest(h, fmt.Sprintf("/api/v1/articles/%d", a), nil)
+	if body := rec.Body.String(); body != fmt.Sprintf(`{"id":%d,"title":"a"}`, a) {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	rec = serveGetTest(h, fmt.Sprintf("/api/v1/articles/%d?fields=summary,outDegree", a), nil)
+	res := db.WikiData{}
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if res.Summary != "Lead of a." || res.OutDegree == nil || *res.OutDegree != 1 ||
+		res.InDegree != nil {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	// # Lists too.
+	rec = serveTest(h, "/api/v1/search/articles/bylinkedfrom",
+		fmt.Sprintf(`{"id":%d, "fields":["inDegree", "outDegree"]}`, b), nil)
+	list := []*db.WikiData{}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != a || list[0].OutDegree == nil ||
+		*list[0].OutDegree != 1 || list[0].InDegree == nil || *list[0].InDegree != 0 {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveGetTest(h, fmt.Sprintf("/api/v1/articles/%d?fields=html", a), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("wanted 400, got %d", rec.Code)
+	}
+}
@@ -1,24 +1,53 @@
 package wapi
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 )
 
+// midRequestID sets the X-Request-Id response header, either to the
+// id sent by the client (if it's sane), or to a new one. This is done
+// first, so all responses (errors in particular) have it.
+func (h *handler) midRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(headerRequestID, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// midTimeout gives the request context a deadline matching the server
+// WriteTimeout, so db queries give up once the response can't be sent
+// anyway. The context is also cancelled if the client disconnects.
+func (h *handler) midTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), h.conf.WriteTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (h *handler) midDOS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ip, ok := extractIP(r)
 		if !ok {
-			w.WriteHeader(http.StatusInternalServerError)
+			h.sendError(w, http.StatusInternalServerError, errInternal,
+				"internal error", fmt.Errorf("no ip in '%s'", r.RemoteAddr))
 			return
 		}
 		// # Check/Register for the purpose of identifying abuse.
-		allow, err := h.cache.CheckRegDOSIP(ip)
+		allow, err := h.cache.CheckRegDOSIP(r.Context(), ip)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			h.sendBackendError(w, err)
 			return
 		}
 		if !allow {
-			w.WriteHeader(http.StatusTooManyRequests)
+			h.sendError(w, http.StatusTooManyRequests, errRateLimited,
+				"too many requests, slow down", nil)
 			return
 		}
 
@@ -0,0 +1,410 @@
+package wapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"wikinodes-server/db"
+)
+
+// The OpenAPI 3 document of the API is built here rather than kept as
+// a file, so that it's next to the handlers and can use the configured
+// bounds (limits and such). Each endpoint of endpointsV1 must have an
+// operation in operationsV1, which is checked by the tests. The doc is
+// served at /api/openapi.json, see routes.
+
+// openAPIPath is where the OpenAPI document is served.
+const openAPIPath = "/api/openapi.json"
+
+// jsonObj is a JSON object, used for building the OpenAPI document.
+type jsonObj map[string]interface{}
+
+// schemaRef refers to the schema <name> in the doc components.
+func schemaRef(name string) jsonObj {
+	return jsonObj{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaObject is an object schema with <props>, where <required>
+// are the names of required props.
+func schemaObject(props jsonObj, required ...string) jsonObj {
+	s := jsonObj{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// schemaArray is an array schema of <items>.
+func schemaArray(items jsonObj) jsonObj {
+	return jsonObj{"type": "array", "items": items}
+}
+
+// schemaInt is an integer schema, where <min> & <max> are left out
+// if negative.
+func schemaInt(description string, min, max int) jsonObj {
+	s := jsonObj{"type": "integer", "description": description}
+	if min >= 0 {
+		s["minimum"] = min
+	}
+	if max >= 0 {
+		s["maximum"] = max
+	}
+	return s
+}
+
+// schemaID is the schema of article ids.
+func schemaID(description string) jsonObj {
+	return jsonObj{"type": "integer", "format": "int64", "minimum": 0,
+		"description": description}
+}
+
+// schemaStr is a string schema with max length <maxLen>, which is
+// left out if negative.
+func schemaStr(description string, maxLen int) jsonObj {
+	s := jsonObj{"type": "string", "description": description}
+	if maxLen >= 0 {
+		s["maxLength"] = maxLen
+	}
+	return s
+}
+
+// schemaList is the schema of list endpoint responses of <items>,
+// which are plain lists or pages (see pagination.go).
+func schemaList(items jsonObj) jsonObj {
+	return jsonObj{"oneOf": []jsonObj{
+		schemaArray(items),
+		schemaObject(jsonObj{
+			"items":      schemaArray(items),
+			"nextCursor": schemaStr("Cursor of the next page, left out on the last page.", -1),
+			"total":      schemaInt("Total amount of items, only set on the last page.", 0, -1),
+		}, "items"),
+	}}
+}
+
+// schemaEdges is the schema of lists of links, such as WikiGraph.Edges.
+func schemaEdges() jsonObj {
+	return jsonObj{
+		"type":        "array",
+		"description": "Links, of form [from id, to id, lookups].",
+		"items": jsonObj{"type": "array", "minItems": 3, "maxItems": 3,
+			"items": jsonObj{"type": "integer", "format": "int64"}},
+	}
+}
+
+// operation is an OpenAPI operation, responding with <res> on success.
+// <req> is the schema of the JSON request body, left out if nil. All
+// operations share the error responses (see errors.go).
+func operation(summary, description string, req, res jsonObj, params ...jsonObj,
+) jsonObj {
+	op := jsonObj{
+		"summary":     summary,
+		"description": description,
+		"responses": jsonObj{
+			"200": jsonObj{
+				"description": "OK",
+				"content":     jsonObj{"application/json": jsonObj{"schema": res}},
+			},
+			"default": jsonObj{"$ref": "#/components/responses/Error"},
+		},
+	}
+	if req != nil {
+		op["requestBody"] = jsonObj{
+			"required": true,
+			"content":  jsonObj{"application/json": jsonObj{"schema": req}},
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	return op
+}
+
+// cacheable adds the responses and headers of GET endpoints that use
+// trySendCacheable to <op>.
+func cacheable(op jsonObj) jsonObj {
+	res := op["responses"].(jsonObj)
+	res["200"].(jsonObj)["headers"] = jsonObj{
+		"ETag":          jsonObj{"schema": jsonObj{"type": "string"}},
+		"Cache-Control": jsonObj{"schema": jsonObj{"type": "string"}},
+	}
+	res["304"] = jsonObj{"description": "Not modified, see If-None-Match."}
+	params, _ := op["parameters"].([]jsonObj)
+	op["parameters"] = append(params, jsonObj{
+		"name": "If-None-Match", "in": "header", "required": false,
+		"schema": jsonObj{"type": "string"},
+	})
+	return op
+}
+
+// param is an OpenAPI parameter <in> either "path" or "query".
+func param(name, in string, required bool, schema jsonObj) jsonObj {
+	return jsonObj{"name": name, "in": in, "required": required, "schema": schema}
+}
+
+// operationsV1 returns the OpenAPI operations of endpointsV1, keyed
+// by "<method> <path>".
+func (h *handler) operationsV1() map[string]jsonObj {
+	c := h.conf
+	limit := schemaInt("Max amount of items, defaults to "+
+		fmt.Sprint(c.PageLimitDefault)+".", 0, c.PageLimitMax)
+	cursor := schemaStr("Cursor of the page to get, use \"\" for the first page. "+
+		"The response is a page if set, else a plain list.", -1)
+	list := schemaList(schemaRef("WikiData"))
+	fields := schemaArray(jsonObj{"type": "string", "enum": db.Fields})
+	fields["description"] = "Optional article fields to include, see WikiData."
+	// # In query strings, fields are comma-separated.
+	fieldsParam := param("fields", "query", false, fields)
+	fieldsParam["style"], fieldsParam["explode"] = "form", false
+
+	return map[string]jsonObj{
+		"POST /search/articles/byid": operation(
+			"Articles by id",
+			"Searches for articles with the given id.",
+			schemaObject(jsonObj{"id": schemaID("Article id."), "cursor": cursor,
+				"fields": fields}, "id"),
+			list),
+		"POST /search/articles/bytitle": operation(
+			"Articles by title",
+			"Searches for articles with the given title.",
+			schemaObject(jsonObj{
+				"title":  schemaStr("Article title.", c.StrMaxLen),
+				"limit":  limit,
+				"cursor": cursor,
+				"fields": fields,
+			}),
+			list),
+		"POST /search/articles/bycontent": operation(
+			"Articles by content",
+			"Full-text search through article content, best matches first. "+
+				"Snippets are HTML with matched terms wrapped in <mark> tags.",
+			schemaObject(jsonObj{
+				"str":    schemaStr("Search string.", c.StrMaxLen),
+				"limit":  limit,
+				"cursor": cursor,
+			}, "str"),
+			schemaList(schemaRef("WikiSearchHit"))),
+		"POST /search/articles/autocomplete": operation(
+			"Title autocompletion",
+			"Articles with titles matching what a user has typed so far, by "+
+				"prefix or with a few typos, best matches first.",
+			schemaObject(jsonObj{
+				"str":    schemaStr("What's typed so far.", c.StrMaxLen),
+				"limit":  limit,
+				"fields": fields,
+			}),
+			schemaArray(schemaRef("WikiData"))),
+		"POST /search/articles/byneigh": operation(
+			"Linked articles",
+			"Articles linked from the article with the given id, randomly "+
+				"ordered. Also used for article recommendation.",
+			schemaObject(jsonObj{"id": schemaID("Article id."), "limit": limit,
+				"fields": fields}, "id"),
+			list),
+		"POST /search/articles/bylinkedfrom": operation(
+			"Backlinks",
+			"Articles linking to the article with the given id, randomly ordered.",
+			schemaObject(jsonObj{"id": schemaID("Article id."), "limit": limit,
+				"fields": fields}, "id"),
+			list),
+		"POST /lookup/articles": operation(
+			"Lookup",
+			"Looks up articles by many ids and titles at once, keyed by input. "+
+				"A title maps to the article with the lowest id among the ones "+
+				"with that title. Inputs without a match are listed as missing.",
+			schemaObject(jsonObj{
+				"ids": jsonObj{"type": "array", "items": schemaID(""),
+					"description": "Article ids, at most " + fmt.Sprint(c.LookupMax) +
+						" ids and titles in total."},
+				"titles": schemaArray(schemaStr("", c.StrMaxLen)),
+				"fields": fields,
+			}),
+			schemaRef("WikiLookup")),
+		"POST /search/html/byid": operation(
+			"Article HTML",
+			"HTML content of the article with the given id.",
+			schemaObject(jsonObj{"id": schemaID("Article id.")}, "id"),
+			jsonObj{"type": "string"}),
+		"POST /search/path": operation(
+			"Shortest path",
+			"Shortest chain of articles linking from one article to another, "+
+				"empty if there is none within maxDepth links.",
+			schemaObject(jsonObj{
+				"from": schemaID("Id of the first article."),
+				"to":   schemaID("Id of the last article."),
+				"maxDepth": schemaInt("Max amount of links, defaults to (and is "+
+					"capped by) "+fmt.Sprint(c.PathMaxDepth)+".", 0, -1),
+				"fields": fields,
+			}, "from", "to"),
+			schemaArray(schemaRef("WikiData"))),
+		"POST /search/subgraph": operation(
+			"Subgraph",
+			"Articles within depth links from the article with the given id, "+
+				"along with all links among them.",
+			schemaObject(jsonObj{
+				"id": schemaID("Article id."),
+				"depth": schemaInt("Max amount of links from the article, defaults "+
+					"to (and is capped by) "+fmt.Sprint(c.SubgraphMaxDepth)+".", 0, -1),
+				"limit": schemaInt("Max amount of articles per level, defaults to "+
+					"(and is capped by) "+fmt.Sprint(c.SubgraphMaxLimit)+".", 0, -1),
+				"fields": fields,
+			}, "id"),
+			schemaRef("WikiGraph")),
+		"POST /check/relsexist": operation(
+			"Check links",
+			"Tells, for each [from, to] pair of article ids, if 'from' links to 'to' "+
+				"(with the lookups weight if lookups is set). If ids is set instead "+
+				"of rels, then all links among those articles are returned.",
+			schemaObject(jsonObj{
+				"rels": jsonObj{
+					"type": "array",
+					"items": jsonObj{"type": "array", "minItems": 2, "maxItems": 2,
+						"items": schemaID("")},
+				},
+				"lookups": jsonObj{"type": "boolean",
+					"description": "Respond with objects rather than booleans."},
+				"ids": jsonObj{"type": "array", "maxItems": c.LookupMax,
+					"items": schemaID("")},
+			}),
+			jsonObj{"oneOf": []jsonObj{
+				schemaArray(jsonObj{"type": "boolean"}),
+				schemaArray(schemaRef("WikiRelCheck")),
+				schemaEdges(),
+			}}),
+		"POST /random/articles": operation(
+			"Random articles",
+			"Randomly picked articles, optionally among the articles linked "+
+				"from an article, or among well-linked articles.",
+			schemaObject(jsonObj{"limit": limit, "fields": fields,
+				"neighOf": schemaID("Only pick articles linked from this article."),
+				"minInDegree": jsonObj{"type": "integer", "minimum": 0,
+					"description": "Only pick articles linked from at least this many."},
+				"seed": jsonObj{"type": "integer",
+					"description": "The same seed gives the same pick."},
+			}),
+			list),
+
+		"GET /articles": cacheable(operation(
+			"Articles by title",
+			"Same as POST /search/articles/bytitle.",
+			nil, list,
+			param("title", "query", true, schemaStr("Article title.", c.StrMaxLen)),
+			param("limit", "query", false, limit),
+			param("cursor", "query", false, cursor),
+			fieldsParam)),
+		"GET /articles/{id}": cacheable(operation(
+			"Article",
+			"The article with the given id.",
+			nil, schemaRef("WikiData"),
+			param("id", "path", true, schemaID("Article id.")),
+			fieldsParam)),
+		"GET /articles/{id}/html": cacheable(operation(
+			"Article HTML",
+			"HTML content of the article with the given id.",
+			nil, jsonObj{"type": "string"},
+			param("id", "path", true, schemaID("Article id.")))),
+		"GET /legacy/articles/{id}": cacheable(operation(
+			"Article by legacy id",
+			"The article which had the given internal id before stable ids, "+
+				"for resolving old links. Not found unless the server "+
+				"has legacy ids enabled.",
+			nil, schemaRef("WikiData"),
+			param("id", "path", true, schemaID("Legacy article id.")))),
+	}
+}
+
+// openAPI returns the OpenAPI document of the API.
+func (h *handler) openAPI() jsonObj {
+	paths := jsonObj{}
+	for k, op := range h.operationsV1() {
+		// # k is "<method> <path>".
+		mp := strings.SplitN(k, " ", 2)
+		item, ok := paths["/api/v1"+mp[1]].(jsonObj)
+		if !ok {
+			item = jsonObj{}
+			paths["/api/v1"+mp[1]] = item
+		}
+		item[strings.ToLower(mp[0])] = op
+	}
+
+	errSchema := schemaObject(jsonObj{
+		"error": schemaObject(jsonObj{
+			"code": jsonObj{"type": "string", "enum": []string{
+				errBadRequest, errNotFound, errMethodNotAllowed, errTooLarge,
+				errRateLimited, errInternal, errUnavailable, errTimeout,
+			}},
+			"message":   schemaStr("Human readable description.", -1),
+			"requestId": schemaStr("Also in the X-Request-Id header.", -1),
+		}, "code", "message", "requestId"),
+	}, "error")
+
+	return jsonObj{
+		"openapi": "3.0.3",
+		"info": jsonObj{
+			"title":   "wikinodes-server",
+			"version": "1",
+			"description": "API for searching Wikipedia articles and the links " +
+				"among them. Unknown fields in request bodies are rejected. The " +
+				"POST endpoints are also served under /data, without a version, " +
+				"for older clients.",
+		},
+		"paths": paths,
+		"components": jsonObj{
+			"schemas": jsonObj{
+				"WikiData": schemaObject(jsonObj{
+					"id":    schemaID("Article id."),
+					"title": schemaStr("Article title.", -1),
+					// # Optional, see db.Fields.
+					db.FieldSummary:   schemaStr("Lead paragraph.", -1),
+					db.FieldOutDegree: schemaInt("Amount of links from the article.", 0, -1),
+					db.FieldInDegree:  schemaInt("Amount of links to the article.", 0, -1),
+					db.FieldLookups: schemaInt("How often the article was navigated "+
+						"to through links.", 0, -1),
+					db.FieldCategories: schemaArray(jsonObj{"type": "string"}),
+					db.FieldUpdated: jsonObj{"type": "string", "format": "date-time",
+						"description": "When the article was last updated."},
+				}, "id", "title"),
+				"WikiLookup": schemaObject(jsonObj{
+					"byId": jsonObj{"type": "object", "description": "Keyed by id.",
+						"additionalProperties": schemaRef("WikiData")},
+					"byTitle": jsonObj{"type": "object", "description": "Keyed by title.",
+						"additionalProperties": schemaRef("WikiData")},
+					"missingIds":    schemaArray(schemaID("")),
+					"missingTitles": schemaArray(jsonObj{"type": "string"}),
+				}, "byId", "byTitle", "missingIds", "missingTitles"),
+				"WikiSearchHit": schemaObject(jsonObj{
+					"id":      schemaID("Article id."),
+					"title":   schemaStr("Article title.", -1),
+					"score":   jsonObj{"type": "number", "description": "Relevance."},
+					"snippet": schemaStr("HTML excerpt of the content.", -1),
+				}, "id", "title", "score", "snippet"),
+				"WikiGraph": schemaObject(jsonObj{
+					"nodes": schemaArray(schemaRef("WikiData")),
+					"edges": schemaEdges(),
+				}, "nodes", "edges"),
+				"WikiRelCheck": schemaObject(jsonObj{
+					"exists":  jsonObj{"type": "boolean"},
+					"lookups": schemaInt("Weight of the link, 0 if it doesn't exist.", 0, -1),
+				}, "exists", "lookups"),
+				"Error": errSchema,
+			},
+			"responses": jsonObj{
+				"Error": jsonObj{
+					"description": "Error, see code.",
+					"headers": jsonObj{
+						headerRequestID: jsonObj{"schema": jsonObj{"type": "string"}},
+					},
+					"content": jsonObj{"application/json": jsonObj{
+						"schema": schemaRef("Error"),
+					}},
+				},
+			},
+		},
+	}
+}
+
+// serveOpenAPI endpoint serves the OpenAPI document of the API.
+// Curl example:
+// 	curl http://ip:port/api/openapi.json
+func (h *handler) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	h.trySendCacheable(w, r, h.openAPI(), h.conf.CacheMaxAge, nil)
+}
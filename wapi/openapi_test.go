@@ -0,0 +1,123 @@
+package wapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"wikinodes-server/config"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+func TestOpenAPICoversEndpoints(t *testing.T) {
+	h := &handler{conf: config.Default().WAPI}
+	ops := h.operationsV1()
+
+	for _, e := range h.endpointsV1() {
+		k := e.method + " " + e.path
+		op, ok := ops[k]
+		if !ok {
+			t.Errorf("no OpenAPI operation for endpoint: %s", k)
+			continue
+		}
+		delete(ops, k)
+		// # Path params must be declared.
+		params, _ := op["parameters"].([]jsonObj)
+		for _, s := range splitPath(e.path) {
+			if !strings.HasPrefix(s, "{") {
+				continue
+			}
+			found := false
+			for _, p := range params {
+				found = found || p["in"] == "path" && "{"+p["name"].(string)+"}" == s
+			}
+			if !found {
+				t.Errorf("%s: path param %s not declared", k, s)
+			}
+		}
+	}
+	for k := range ops {
+		t.Errorf("OpenAPI operation without endpoint: %s", k)
+	}
+}
+
+func TestOpenAPIRequiredOptions(t *testing.T) {
+	m := memgraph.New()
+	id := m.AddArticle("a", "a", "")
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	for _, e := range h.endpointsV1() {
+		op := h.operationsV1()[e.method+" "+e.path]
+		body, ok := op["requestBody"].(jsonObj)
+		if !ok {
+			continue
+		}
+		schema := body["content"].(jsonObj)["application/json"].(jsonObj)["schema"].(jsonObj)
+		props, _ := schema["properties"].(jsonObj)
+		required, _ := schema["required"].([]string)
+		// # Valid values of required options.
+		valid := make(map[string]interface{})
+		for _, name := range required {
+			switch props[name].(jsonObj)["type"] {
+			case "integer":
+				valid[name] = id
+			case "string":
+				valid[name] = "a"
+			default:
+				t.Fatalf("%s: no valid value for option %s", e.path, name)
+			}
+		}
+
+		// # All required options set: not a bad request.
+		b, _ := json.Marshal(valid)
+		if rec := serveTest(h, "/api/v1"+e.path, string(b), nil); rec.Code == http.StatusBadRequest {
+			t.Errorf("%s %s: unexpected bad request: %s", e.path, b, rec.Body.String())
+		}
+		// # Any required option left out: a bad request naming it.
+		for _, name := range required {
+			options := make(map[string]interface{})
+			for k, v := range valid {
+				if k != name {
+					options[k] = v
+				}
+			}
+			b, _ := json.Marshal(options)
+			rec := serveTest(h, "/api/v1"+e.path, string(b), nil)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s %s: wanted bad request for %s, got %d",
+					e.path, b, name, rec.Code)
+				continue
+			}
+			if res := unpackAPIError(t, rec); !strings.Contains(res.Error.Message, name) {
+				t.Errorf("%s %s: wanted a problem with %s, got %+v", e.path, b, name, res)
+			}
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	conf := config.Default()
+	h := &handler{db: memgraph.New(), cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	rec := serveGetTest(h, openAPIPath, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	doc := struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("unexpected version: %s", doc.OpenAPI)
+	}
+	for _, e := range h.endpointsV1() {
+		if _, ok := doc.Paths["/api/v1"+e.path][strings.ToLower(e.method)]; !ok {
+			t.Errorf("endpoint missing from served doc: %s %s", e.method, e.path)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package wapi
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"wikinodes-server/db"
+)
+
+// List endpoints respond with a plain JSON list by default, which
+// is what the app has always used. When a request includes the
+// 'cursor' option (an empty string for the first page), then the
+// response is wrapped in a page instead, which can be used for
+// 'load more' functionality.
+
+// cursorPrefix makes cursors a little less guessable as offsets,
+// they are meant to be opaque to clients.
+const cursorPrefix = "o:"
+
+// page is the envelope for paginated list responses. NextCursor
+// is left out when there are no more items, Total is left out
+// when it isn't known (it's only known for the last page).
+type page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+	Total      *int        `json:"total,omitempty"`
+}
+
+// encodeCursor encodes an offset into an opaque cursor.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// decodeCursor decodes a cursor made with encodeCursor into an
+// offset. An empty cursor means the first page, i.e offset 0.
+// Offsets above <max> are invalid, since cursors can be crafted.
+func decodeCursor(cursor string, max int) (int, bool) {
+	if cursor == "" {
+		return 0, true
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), cursorPrefix) {
+		return 0, false
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(b), cursorPrefix))
+	if err != nil || offset < 0 || offset > max {
+		return 0, false
+	}
+	return offset, true
+}
+
+// tryDecodeCursor is decodeCursor for an optional cursor, where a
+// nil cursor means offset 0 (max is wapi.page_offset_max). If the
+// cursor is invalid, then a bad request response is sent and false
+// is returned.
+func (h *handler) tryDecodeCursor(w http.ResponseWriter, cursor *string,
+) (int, bool) {
+	if cursor == nil {
+		return 0, true
+	}
+	offset, ok := decodeCursor(*cursor, h.conf.PageOffsetMax)
+	if !ok {
+		h.sendBadRequest(w, "invalid cursor")
+	}
+	return offset, ok
+}
+
+// trimPage cuts <items> down to <limit>, telling if there were more
+// than that. The idea is to fetch limit+1 items, to know whether
+// there's a next page without having to count everything.
+func trimPage(items []*db.WikiData, limit int) ([]*db.WikiData, bool) {
+	if len(items) > limit {
+		return items[:limit], true
+	}
+	return items, false
+}
+
+// pageOf returns what list endpoints respond with. <items> should
+// be a list of length <n>, fetched from <offset>. <more> tells if
+// there are items after these. If <cursor> is nil, then the items
+// are returned as-is (plain list), else they're wrapped in a page.
+// Randomly ordered lists can't be paged, so those endpoints reject
+// cursors instead (see noCursor).
+func pageOf(cursor *string, items interface{}, n, offset int, more bool,
+) interface{} {
+	if cursor == nil {
+		return items
+	}
+	p := page{Items: items}
+	if more {
+		p.NextCursor = encodeCursor(offset + n)
+	}
+	if !more {
+		total := offset + n
+		p.Total = &total
+	}
+	return p
+}
+
+// trySendPage is trySendWikiData for list endpoints, see pageOf
+// for the args.
+func (h *handler) trySendPage(w http.ResponseWriter, cursor *string,
+	items interface{}, n, offset int, more bool, fetcherr error,
+) {
+	if fetcherr != nil {
+		h.trySendWikiData(w, items, fetcherr)
+		return
+	}
+	h.trySendWikiData(w, pageOf(cursor, items, n, offset, more), nil)
+}
@@ -0,0 +1,104 @@
+package wapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 10, 12345} {
+		got, ok := decodeCursor(encodeCursor(offset), 12345)
+		if !ok || got != offset {
+			t.Fatalf("round trip of %v failed: %v, %v", offset, got, ok)
+		}
+	}
+	for _, cursor := range []string{"nope", encodeCursor(-1), encodeCursor(12346), "bzo="} {
+		if _, ok := decodeCursor(cursor, 12345); ok {
+			t.Fatalf("expected invalid cursor: %v", cursor)
+		}
+	}
+}
+
+func TestSearchArticlesByContentPages(t *testing.T) {
+	m := memgraph.New()
+	for i := 0; i < 5; i++ {
+		m.AddArticle(fmt.Sprint(i), strings.Repeat("x ", 5-i), "")
+	}
+	conf := config.Default()
+	h := handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	// # Follow cursors until there is no next page.
+	titles := make([]string, 0)
+	cursor := ""
+	for i := 0; i < 10; i++ {
+		body := fmt.Sprintf(`{"str":"x", "limit":2, "cursor":"%s"}`, cursor)
+		rec := httptest.NewRecorder()
+		h.searchArticlesByContent(rec,
+			httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+		p := struct {
+			Items      []*db.WikiData `json:"items"`
+			NextCursor string         `json:"nextCursor"`
+			Total      *int           `json:"total"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range p.Items {
+			titles = append(titles, v.Title)
+		}
+		if p.NextCursor == "" {
+			if p.Total == nil || *p.Total != 5 {
+				t.Fatalf("expected total 5 on last page, got: %v", p.Total)
+			}
+			break
+		}
+		cursor = p.NextCursor
+	}
+	if fmt.Sprint(titles) != "[0 1 2 3 4]" {
+		t.Fatalf("unexpected pages: %v", titles)
+	}
+
+	// # Without a cursor, the response is a plain list.
+	rec := httptest.NewRecorder()
+	h.searchArticlesByContent(rec, httptest.NewRequest(
+		http.MethodPost, "/", strings.NewReader(`{"str":"x", "limit":2}`)))
+	list := make([]*db.WikiData, 0)
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("unexpected plain list: %v", list)
+	}
+}
+
+func TestSearchArticlesByIDPages(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "", "")
+	conf := config.Default()
+	h := handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	// # A single page, nothing past it.
+	cases := []struct{ cursor, want string }{
+		{"", fmt.Sprintf(`{"items":[{"id":%d,"title":"a"}],"total":1}`, a)},
+		{encodeCursor(1), `{"items":[],"total":1}`},
+		{encodeCursor(5), `{"items":[],"total":1}`},
+	}
+	for _, c := range cases {
+		body := fmt.Sprintf(`{"id":%d, "cursor":"%s"}`, a, c.cursor)
+		rec := httptest.NewRecorder()
+		h.searchArticlesByID(rec,
+			httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rec.Code != http.StatusOK || rec.Body.String() != c.want {
+			t.Fatalf("%s: wanted %s, got %d, %s", body, c.want, rec.Code, rec.Body.String())
+		}
+	}
+}
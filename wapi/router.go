@@ -0,0 +1,109 @@
+package wapi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// router dispatches requests by method and path. Path patterns are
+// split into segments, where segments of form {name} match any
+// (non-empty) segment, which handlers get with pathParam. Requests
+// with a known path but a method no route has get methodNotAllowed
+// (with the Allow header set), other requests get notFound.
+type router struct {
+	routes           []route
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+// route is a single pattern registered with router.handle.
+type route struct {
+	method   string
+	segments []string
+	handler  http.Handler
+}
+
+// pathParamsKey is the context key for path params.
+type pathParamsKey struct{}
+
+// splitPath splits a path into segments, ignoring leading and
+// trailing slashes.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// handle registers <handler> for <method> requests to <pattern>. GET
+// routes also match HEAD requests. Routes are matched in the order
+// they are registered.
+func (rt *router) handle(method, pattern string, handler http.Handler) {
+	rt.routes = append(rt.routes, route{
+		method:   method,
+		segments: splitPath(pattern),
+		handler:  handler,
+	})
+}
+
+// match tells if <segments> match the route pattern, returning the
+// path params if so.
+func (rte *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rte.segments) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, s := range rte.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[s[1:len(s)-1]] = segments[i]
+			continue
+		}
+		if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ServeHTTP implements http.Handler.
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+	allowed := make([]string, 0)
+	for i := range rt.routes {
+		rte := &rt.routes[i]
+		params, ok := rte.match(segments)
+		if !ok {
+			continue
+		}
+		if r.Method == rte.method ||
+			r.Method == http.MethodHead && rte.method == http.MethodGet {
+			if params != nil {
+				r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+			}
+			rte.handler.ServeHTTP(w, r)
+			return
+		}
+		allowed = append(allowed, rte.method)
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		rt.methodNotAllowed.ServeHTTP(w, r)
+		return
+	}
+	rt.notFound.ServeHTTP(w, r)
+}
+
+// pathParam returns the path param <name> of a request dispatched
+// by router, see router.handle.
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
@@ -0,0 +1,95 @@
+package wapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wikinodes-server/config"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+func TestRouterMatch(t *testing.T) {
+	got := ""
+	rt := &router{
+		notFound: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = "404"
+		}),
+		methodNotAllowed: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = "405 " + w.Header().Get("Allow")
+		}),
+	}
+	route := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = name + pathParam(r, "id")
+		})
+	}
+	rt.handle(http.MethodGet, "/a", route("a"))
+	rt.handle(http.MethodGet, "/a/{id}", route("a/"))
+	rt.handle(http.MethodPost, "/a/{id}", route("post a/"))
+	rt.handle(http.MethodGet, "/a/{id}/b", route("b/"))
+
+	cases := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/a", "a"},
+		{http.MethodGet, "/a/", "a"},
+		{http.MethodHead, "/a", "a"},
+		{http.MethodGet, "/a/1", "a/1"},
+		{http.MethodPost, "/a/1", "post a/1"},
+		{http.MethodGet, "/a/1/b", "b/1"},
+		{http.MethodDelete, "/a/1", "405 GET, POST"},
+		{http.MethodPost, "/a", "405 GET"},
+		{http.MethodGet, "/a//b", "404"},
+		{http.MethodGet, "/a/1/c", "404"},
+		{http.MethodGet, "/", "404"},
+	}
+	for _, c := range cases {
+		got = ""
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(c.method, c.path, nil))
+		if got != c.want {
+			t.Errorf("%s %s: wanted '%s', got '%s'", c.method, c.path, c.want, got)
+		}
+	}
+}
+
+func TestRoutesVersions(t *testing.T) {
+	m := memgraph.New()
+	id := m.AddArticle("a", "", "")
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+	body := fmt.Sprintf(`{"id":%d}`, id)
+
+	// # Legacy routes are the same as v1.
+	v1 := serveTest(h, "/api/v1/search/articles/byid", body, nil)
+	legacy := serveTest(h, "/data/search/articles/byid", body, nil)
+	if v1.Code != http.StatusOK || v1.Body.String() != legacy.Body.String() {
+		t.Fatalf("unexpected responses: %d, %s vs %d, %s",
+			v1.Code, v1.Body.String(), legacy.Code, legacy.Body.String())
+	}
+
+	// # Wrong methods.
+	for _, path := range []string{"/api/v1/search/articles/byid", "/data/search/articles/byid"} {
+		rec := serveGetTest(h, path, nil)
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+			t.Fatalf("%s: unexpected response: %d, %v", path, rec.Code, rec.Header())
+		}
+		if res := unpackAPIError(t, rec); res.Error.Code != errMethodNotAllowed {
+			t.Fatalf("%s: unexpected code: %+v", path, res)
+		}
+	}
+	rec := serveTest(h, "/api/v1/articles", "", nil)
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Fatalf("unexpected response: %d, %v", rec.Code, rec.Header())
+	}
+
+	// # Unknown API paths (including other versions) aren't the React app.
+	for _, path := range []string{"/api/v2/articles", "/api/v1/nope", "/data/nope"} {
+		rec := serveGetTest(h, path, nil)
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), errNotFound) {
+			t.Fatalf("%s: unexpected response: %d, %s", path, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -1,47 +1,122 @@
 package wapi
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"wikinodes-server/db"
 )
 
-// setRoutes sets up routes for this API.
-func (h *handler) setRoutes() {
-	// # Serve static
-	http.Handle("/", http.FileServer(http.Dir(pathToReactApp)))
+// endpoint is an API endpoint, where path is relative to the prefix
+// of the API version (e.g /api/v1).
+type endpoint struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+// endpointsV1 returns the endpoints of /api/v1. Once released, these
+// shouldn't change in incompatible ways. Breaking changes go in a new
+// version instead (i.e endpointsV2, served under /api/v2 next to v1),
+// so that older clients keep working.
+func (h *handler) endpointsV1() []endpoint {
+	return []endpoint{
+		{http.MethodPost, "/search/articles/byid", h.searchArticlesByID},
+		{http.MethodPost, "/search/articles/bytitle", h.searchArticlesByTitle},
+		{http.MethodPost, "/search/articles/bycontent", h.searchArticlesByContent},
+		{http.MethodPost, "/search/articles/autocomplete", h.searchArticlesAutocomplete},
+		{http.MethodPost, "/search/articles/byneigh", h.searchArticlesByNeighs},
+		{http.MethodPost, "/search/articles/bylinkedfrom", h.searchArticlesByBacklinks},
+		{http.MethodPost, "/lookup/articles", h.lookupArticles},
+		{http.MethodPost, "/search/html/byid", h.searchHMLByID},
+		{http.MethodPost, "/search/path", h.searchPath},
+		{http.MethodPost, "/search/subgraph", h.searchSubgraph},
+		{http.MethodPost, "/check/relsexist", h.checkRelsExist},
+		{http.MethodPost, "/random/articles", h.randomArticles},
+
+		// # GET, see get.go.
+		{http.MethodGet, "/articles", h.getArticles},
+		{http.MethodGet, "/articles/{id}", h.getArticle},
+		{http.MethodGet, "/articles/{id}/html", h.getArticleHTML},
+		{http.MethodGet, "/legacy/articles/{id}", h.getLegacyArticle},
+	}
+}
 
-	routes := map[string]func(w http.ResponseWriter, r *http.Request){
-		"/data/search/articles/byid":      h.searchArticlesByID,
-		"/data/search/articles/bytitle":   h.searchArticlesByTitle,
-		"/data/search/articles/bycontent": h.searchArticlesByContent,
-		"/data/search/articles/byneigh":   h.searchArticlesByNeighs,
-		"/data/search/html/byid":          h.searchHMLByID,
+// legacyPrefix is where the POST endpoints of v1 were served before
+// the API was versioned, still used by the React app.
+const legacyPrefix = "/data"
 
-		"/data/check/relsexist": h.checkRelsExist,
-		"/data/random/articles": h.randomArticles,
+// routes returns the handler for all routes of this API: versioned
+// endpoints under /api/<version>, legacy ones under /data and the
+// React app for everything else.
+func (h *handler) routes() http.Handler {
+	rt := &router{
+		notFound: http.HandlerFunc(h.notFound),
+		methodNotAllowed: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.sendError(w, http.StatusMethodNotAllowed, errMethodNotAllowed,
+				fmt.Sprintf("%s not allowed for %s", r.Method, r.URL.Path), nil)
+		}),
 	}
-	for k, v := range routes {
-		http.Handle(k, h.midDOS(http.HandlerFunc(v)))
-		fmt.Printf("route: '%s' is up. \n", k)
+	handle := func(method, path string, handler http.HandlerFunc) {
+		rt.handle(method, path, h.midTimeout(h.midDOS(handler)))
+		fmt.Printf("route: '%s %s' is up. \n", method, path)
 	}
+
+	versions := []struct {
+		prefix    string
+		endpoints []endpoint
+	}{
+		{"/api/v1", h.endpointsV1()},
+	}
+	for _, v := range versions {
+		for _, e := range v.endpoints {
+			handle(e.method, v.prefix+e.path, e.handler)
+		}
+	}
+	for _, e := range h.endpointsV1() {
+		if e.method == http.MethodPost {
+			handle(e.method, legacyPrefix+e.path, e.handler)
+		}
+	}
+	handle(http.MethodGet, openAPIPath, h.serveOpenAPI)
+	return h.midRequestID(rt)
+}
+
+// notFound sends a not_found error for unknown API paths, anything
+// else is served from the React app.
+func (h *handler) notFound(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") ||
+		strings.HasPrefix(r.URL.Path, legacyPrefix+"/") {
+		h.sendNotFound(w, "no such endpoint: "+r.URL.Path)
+		return
+	}
+	h.static.ServeHTTP(w, r)
 }
 
 // trySendWikiDataAny takes any <data>, then tries to marshal- and
 // send it to a client. Here, this is meant to send any WikiData.
+// If <fetcherr> is set, then an error response is sent instead.
 func (h *handler) trySendWikiData(
 	w http.ResponseWriter, data interface{}, fetcherr error) {
 	if fetcherr != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.sendBackendError(w, fetcherr)
 		return
 	}
 
 	b, err := json.Marshal(data)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.sendError(w, http.StatusInternalServerError, errInternal,
+			"internal error", err)
+		return
 	}
 	// # Respond.
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(b)
 }
@@ -49,72 +124,250 @@ func (h *handler) trySendWikiData(
 // tryUnpackRequestOptions will try to unmarshal the request body into
 // <targetOpt>. If the task fails, then an automatic bad request
 // response is sent to the requester and false is returned. Else,
-// nothing is written to the requester and the return is true.
+// nothing is written to the requester and the return is true. Bodies
+// over the configured size, unknown fields and trailing data are all
+// rejected.
 func (h *handler) tryUnpackRequestOptions(
 	w http.ResponseWriter, r *http.Request, targetOpt interface{}) bool {
-	// # Error is not necessary to check, if it's not nil then
-	// # the body with JSON request isn't going to work anyway.
-	body, _ := ioutil.ReadAll(r.Body)
-	err := json.Unmarshal(body, targetOpt)
+	max := h.conf.MaxBodyBytes
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, int64(max)))
+	if err != nil {
+		// # MaxBytesReader reads up to max before failing.
+		if len(body) >= max {
+			h.sendError(w, http.StatusRequestEntityTooLarge, errTooLarge,
+				fmt.Sprintf("request body can't exceed %d bytes", max), nil)
+			return false
+		}
+		h.sendBadRequest(w, "couldn't read request body")
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(targetOpt)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after options")
+	}
+	if err != nil {
+		h.sendBadRequest(w, "invalid JSON options: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// tryCheckArticlesExist checks that there are articles with all of
+// <ids>, for telling missing articles apart from empty results. If
+// not (or on error), then an error response is sent and false is
+// returned.
+func (h *handler) tryCheckArticlesExist(
+	w http.ResponseWriter, r *http.Request, ids ...int64) bool {
+	res, err := h.db.LookupArticles(r.Context(), ids, nil)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		h.sendBackendError(w, err)
+		return false
+	}
+	if len(res.MissingIDs) > 0 {
+		h.sendNotFound(w, fmt.Sprintf("no article with id %d", res.MissingIDs[0]))
 		return false
 	}
 	return true
 }
 
-// searchArticlesByID endpoint accepts a JSON option {id:int}, where the
-// id is used to search a database for an article with that id.
+// withFields sets the optional <fields> of <data> (see db.Fields),
+// unless <fetcherr> is set or no fields are asked for. The resulting
+// error is returned, to be passed on to the trySend funcs. Endpoints
+// that respond with articles take these as a 'fields' option, e.g
+// {"id":4279, "fields":["summary","inDegree"]}, so that lists stay
+// small unless more is asked for.
+func (h *handler) withFields(ctx context.Context,
+	data []*db.WikiData, fields []string, fetcherr error) error {
+	if fetcherr != nil || len(fields) == 0 || len(data) == 0 {
+		return fetcherr
+	}
+	return h.db.FillArticleFields(ctx, data, fields)
+}
+
+// searchArticlesByID endpoint accepts a JSON option {id:int, cursor:string},
+// where the id is used to search a database for an article with that id. The
+// cursor is optional, see pagination.go.
 // Curl example:
 // 	curl http://ip:port/data/search/articles/byid -d "{\"id\":4279}"
 func (h *handler) searchArticlesByID(w http.ResponseWriter, r *http.Request) {
 	// # Try get JSON options.
 	options := struct {
-		ID int64 `json:"id"`
+		ID     *int64   `json:"id"`
+		Cursor *string  `json:"cursor"`
+		Fields []string `json:"fields"`
+	}{}
+	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
+		return
+	}
+	offset, ok := h.tryDecodeCursor(w, options.Cursor)
+	if !ok {
+		return
+	}
+	v := optionsValidator{}
+	v.requiredID("id", options.ID)
+	v.fields("fields", options.Fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search; there's a single page, so skip past it.
+	res, err := h.db.SearchArticlesByID(r.Context(), *options.ID)
+	if offset > len(res) {
+		offset = len(res)
+	}
+	res = res[offset:]
+	err = h.withFields(r.Context(), res, options.Fields, err)
+	// # Try response.
+	h.trySendPage(w, options.Cursor, res, len(res), offset, false, err)
+}
+
+// lookupArticles endpoint accepts a JSON option {ids:[int], titles:[string],
+// fields:[string]}, where articles are looked up by all ids and titles at once
+// (at most a configured amount in total). The result is of form {byId:{id:
+// article}, byTitle:{title:article}, missingIds:[int], missingTitles:[string]},
+// see db.WikiLookup. The fields option is optional, see withFields.
+// Curl example:
+// 	curl http://ip:port/data/lookup/articles -d "{\"ids\":[4279, 8], \"titles\":[\"Art\"]}"
+func (h *handler) lookupArticles(w http.ResponseWriter, r *http.Request) {
+	// # Try get JSON options.
+	options := struct {
+		IDs    []int64  `json:"ids"`
+		Titles []string `json:"titles"`
+		Fields []string `json:"fields"`
 	}{}
 	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
 		return
 	}
+	v := optionsValidator{}
+	v.check(len(options.IDs)+len(options.Titles) <= h.conf.LookupMax,
+		"ids and titles can't have more than %d items in total", h.conf.LookupMax)
+	for _, id := range options.IDs {
+		if id < 0 {
+			v.check(false, "ids can't be negative")
+			break
+		}
+	}
+	for _, title := range options.Titles {
+		if len(title) > h.conf.StrMaxLen {
+			v.check(false, "titles can't be longer than %d bytes", h.conf.StrMaxLen)
+			break
+		}
+	}
+	v.fields("fields", options.Fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
 	// # Try db search.
-	res, err := h.db.SearchArticlesByID(options.ID)
+	res, err := h.db.LookupArticles(r.Context(), options.IDs, options.Titles)
+	if err == nil {
+		err = h.withFields(r.Context(), res.Articles(), options.Fields, nil)
+	}
 	// # Try response.
 	h.trySendWikiData(w, res, err)
 }
 
-// searchArticlesByTitle endpoint accepts a JSON option {title:string}, where the
-// title is used to search a database for an article with that title.
+// searchArticlesByTitle endpoint accepts a JSON option {title:string, limit:int,
+// cursor:string}, where the title is used to search a database for articles with
+// that title. The limit and cursor are optional, see pagination.go.
 // Curl example:
 // 	curl http://ip:port/data/search/articles/bytitle -d "{\"title\":\"Art\"}"
 func (h *handler) searchArticlesByTitle(w http.ResponseWriter, r *http.Request) {
 	// # Try get JSON options.
 	options := struct {
-		Title string `json:"title"`
+		Title  string   `json:"title"`
+		Limit  int      `json:"limit"`
+		Cursor *string  `json:"cursor"`
+		Fields []string `json:"fields"`
 	}{}
 	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
 		return
 	}
-	// # Try db search.
-	res, err := h.db.SearchArticlesByTitle(options.Title)
+	offset, ok := h.tryDecodeCursor(w, options.Cursor)
+	if !ok {
+		return
+	}
+	v := optionsValidator{}
+	v.str("title", options.Title, h.conf.StrMaxLen, false)
+	v.limit("limit", &options.Limit, h.conf.PageLimitDefault, h.conf.PageLimitMax)
+	v.fields("fields", options.Fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search, +1 to see if there's a next page.
+	res, err := h.db.SearchArticlesByTitle(r.Context(),
+		options.Title, offset, options.Limit+1)
+	res, more := trimPage(res, options.Limit)
+	err = h.withFields(r.Context(), res, options.Fields, err)
 	// # Try response.
-	h.trySendWikiData(w, res, err)
+	h.trySendPage(w, options.Cursor, res, len(res), offset, more, err)
 }
 
-// searchArticlesByContent endpoint accepts a JOSN option {str:string, limit:int},
-// where str is used to search a database for articles that have that string inside
-// the bulk content (general search) -- the limit option limits the response.
+// searchArticlesByContent endpoint accepts a JOSN option {str:string, limit:int,
+// cursor:string}, where str is used to search a database for articles that have
+// that string inside the bulk content (general search) -- the limit option limits
+// the response. The cursor is optional, see pagination.go. Results are of form
+// {id:int, title:string, score:float, snippet:string}, where snippet is an html
+// excerpt of the content with matched terms wrapped in <mark> tags.
 // Curl example:
 // 	curl http://ip:port/data/search/articles/bycontent -d "{\"str\":\"the\", \"limit\":1}"
 func (h *handler) searchArticlesByContent(w http.ResponseWriter, r *http.Request) {
 	// # Try get JSON options.
 	options := struct {
-		Str   string `json:"str"`
-		Limit int    `json:"limit"`
+		Str    string  `json:"str"`
+		Limit  int     `json:"limit"`
+		Cursor *string `json:"cursor"`
 	}{}
 	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
 		return
 	}
+	offset, ok := h.tryDecodeCursor(w, options.Cursor)
+	if !ok {
+		return
+	}
+	v := optionsValidator{}
+	v.str("str", options.Str, h.conf.StrMaxLen, true)
+	v.limit("limit", &options.Limit, h.conf.PageLimitDefault, h.conf.PageLimitMax)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search, +1 to see if there's a next page.
+	res, err := h.db.SearchArticlesByContent(r.Context(),
+		options.Str, offset, options.Limit+1)
+	more := len(res) > options.Limit
+	if more {
+		res = res[:options.Limit]
+	}
+	// # Try response.
+	h.trySendPage(w, options.Cursor, res, len(res), offset, more, err)
+}
+
+// searchArticlesAutocomplete endpoint accepts a JSON option {str:string, limit:int},
+// where str is what a user has typed so far. Articles with titles that match it
+// (case-insensitively) by prefix or with a few typos are returned, best matches
+// first -- the limit option limits the result.
+// Curl example:
+// 	curl http://ip:port/data/search/articles/autocomplete -d "{\"str\":\"last thu\", \"limit\":5}"
+func (h *handler) searchArticlesAutocomplete(w http.ResponseWriter, r *http.Request) {
+	// # Try get JSON options.
+	options := struct {
+		Str    string   `json:"str"`
+		Limit  int      `json:"limit"`
+		Fields []string `json:"fields"`
+	}{}
+	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
+		return
+	}
+	v := optionsValidator{}
+	v.str("str", options.Str, h.conf.StrMaxLen, false)
+	v.limit("limit", &options.Limit, h.conf.PageLimitDefault, h.conf.PageLimitMax)
+	v.fields("fields", options.Fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
 	// # Try db search.
-	res, err := h.db.SearchArticlesByContent(options.Str, options.Limit)
+	res, err := h.db.SearchArticlesByTitleFuzzy(r.Context(), options.Str, options.Limit)
+	err = h.withFields(r.Context(), res, options.Fields, err)
 	// # Try response.
 	h.trySendWikiData(w, res, err)
 }
@@ -122,49 +375,189 @@ func (h *handler) searchArticlesByContent(w http.ResponseWriter, r *http.Request
 // searchArticlesByNeighs endpoint accepts a JSON option {id:int, limit:int}, where
 // id searches for a database for an article 'A' with that id, then returns all
 // neighbours of 'A' (hyperlinked from 'A') -- the limit option limits the result.
+// The order is random (weighted by lookups), so there are no pages; a cursor
+// option is rejected, just call this again.
 // Curl example:
 // 	curl http://ip:port/data/search/articles/byneigh -d "{\"id\":4394, \"limit\":1}"
 func (h *handler) searchArticlesByNeighs(w http.ResponseWriter, r *http.Request) {
 	// # Try get JSON options.
 	options := struct {
-		ID    int64 `json:"id"`
-		Limit int   `json:"limit"`
+		ID     *int64   `json:"id"`
+		Limit  int      `json:"limit"`
+		Cursor *string  `json:"cursor"`
+		Fields []string `json:"fields"`
 	}{}
 	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
 		return
 	}
+	v := optionsValidator{}
+	v.requiredID("id", options.ID)
+	v.limit("limit", &options.Limit, h.conf.PageLimitDefault, h.conf.PageLimitMax)
+	v.fields("fields", options.Fields)
+	v.noCursor("cursor", options.Cursor)
+	if !h.tryValidate(w, &v) {
+		return
+	}
 	// # Check what the user searched for last time and use that, if
 	// # possible, to increment the relationship between the
 	// # last wiki id -> current wiki id. Used for article recommendation.
 	if ip, ok := extractIP(r); ok {
 		// # Incr the rel if last id is found.
-		if lastID, ok := h.cache.LastQueryID(ip); ok {
-			h.db.IncrementRel(lastID, options.ID)
+		if lastID, ok := h.cache.LastQueryID(r.Context(), ip); ok {
+			h.db.IncrementRel(r.Context(), lastID, *options.ID)
 		}
 		// # Update cache with new id.
-		h.cache.SetLastQueryID(ip, options.ID)
+		h.cache.SetLastQueryID(r.Context(), ip, *options.ID)
 	}
 	// # Try db search.
-	res, err := h.db.SearchArticlesNeighsByID(options.ID, options.Limit)
+	res, err := h.db.SearchArticlesNeighsByID(r.Context(),
+		*options.ID, options.Limit)
+	err = h.withFields(r.Context(), res, options.Fields, err)
+	// # Try response.
+	h.trySendWikiData(w, res, err)
+}
+
+// searchArticlesByBacklinks endpoint accepts a JSON option {id:int, limit:int},
+// where id searches a database for an article 'A' with that id, then returns
+// all articles that link to 'A' -- the limit option limits the result. This is
+// the counterpart of searchArticlesByNeighs, but doesn't affect recommendation.
+// As with searchArticlesByNeighs, there are no pages.
+// Curl example:
+// 	curl http://ip:port/data/search/articles/bylinkedfrom -d "{\"id\":8, \"limit\":1}"
+func (h *handler) searchArticlesByBacklinks(w http.ResponseWriter, r *http.Request) {
+	// # Try get JSON options.
+	options := struct {
+		ID     *int64   `json:"id"`
+		Limit  int      `json:"limit"`
+		Cursor *string  `json:"cursor"`
+		Fields []string `json:"fields"`
+	}{}
+	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
+		return
+	}
+	v := optionsValidator{}
+	v.requiredID("id", options.ID)
+	v.limit("limit", &options.Limit, h.conf.PageLimitDefault, h.conf.PageLimitMax)
+	v.fields("fields", options.Fields)
+	v.noCursor("cursor", options.Cursor)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search.
+	res, err := h.db.SearchArticlesBacklinksByID(r.Context(),
+		*options.ID, options.Limit)
+	err = h.withFields(r.Context(), res, options.Fields, err)
 	// # Try response.
 	h.trySendWikiData(w, res, err)
 }
 
 // searchHTMLByID endpoint accepts a JSON option {id:int}, where the id
 // is used to search a database for an article. Then, the HTML content
-// of that article is returned.
+// of that article is returned (a not_found error if there is none).
 // Curl example:
 // 	curl http://ip:port/data/search/html/byid -d "{\"id\":4394}"
 func (h *handler) searchHMLByID(w http.ResponseWriter, r *http.Request) {
 	// # Try get JSON option.
 	options := struct {
-		ID int64 `json:"id"`
+		ID *int64 `json:"id"`
+	}{}
+	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
+		return
+	}
+	v := optionsValidator{}
+	v.requiredID("id", options.ID)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search.
+	res, err := h.db.SearchArticlesHTMLByID(r.Context(), *options.ID)
+	// # Empty html might be a missing article.
+	if err == nil && res == "" && !h.tryCheckArticlesExist(w, r, *options.ID) {
+		return
+	}
+	// # Try response.
+	h.trySendWikiData(w, res, err)
+}
+
+// searchPath endpoint accepts a JSON option {from:int, to:int, maxDepth:int},
+// where from and to are article ids. The shortest chain of articles linking
+// from the former to the latter is returned, starting with 'from' and ending
+// with 'to' (an empty list if there is none, a not_found error if either
+// article doesn't exist). maxDepth limits the amount of links in the chain,
+// it defaults to (and is capped by) a configured maximum.
+// Curl example:
+// 	curl http://ip:port/data/search/path -d "{\"from\":4394, \"to\":8, \"maxDepth\":3}"
+func (h *handler) searchPath(w http.ResponseWriter, r *http.Request) {
+	// # Try get JSON options.
+	options := struct {
+		From     *int64   `json:"from"`
+		To       *int64   `json:"to"`
+		MaxDepth int      `json:"maxDepth"`
+		Fields   []string `json:"fields"`
 	}{}
 	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
 		return
 	}
+	v := optionsValidator{}
+	v.requiredID("from", options.From)
+	v.requiredID("to", options.To)
+	v.capped("maxDepth", &options.MaxDepth, h.conf.PathMaxDepth)
+	v.fields("fields", options.Fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
 	// # Try db search.
-	res, err := h.db.SearchArticlesHTMLByID(options.ID)
+	res, err := h.db.SearchArticlesPathByIDs(r.Context(),
+		*options.From, *options.To, options.MaxDepth)
+	err = h.withFields(r.Context(), res, options.Fields, err)
+	// # No path might be a missing article.
+	if err == nil && len(res) == 0 &&
+		!h.tryCheckArticlesExist(w, r, *options.From, *options.To) {
+		return
+	}
+	// # Try response.
+	h.trySendWikiData(w, res, err)
+}
+
+// searchSubgraph endpoint accepts a JSON option {id:int, depth:int, limit:int},
+// where id is used to search a database for an article 'A'. The articles within
+// depth links from 'A' are returned along with all links among them, as a JSON
+// of form {nodes:[{id:int, title:string}], edges:[[from, to, lookups]]}. limit
+// caps the amount of articles added per level. Both depth and limit default to
+// (and are capped by) configured maximums. If 'A' doesn't exist, then a not_found
+// error is returned.
+// Curl example:
+// 	curl http://ip:port/data/search/subgraph -d "{\"id\":4394, \"depth\":2, \"limit\":5}"
+func (h *handler) searchSubgraph(w http.ResponseWriter, r *http.Request) {
+	// # Try get JSON options.
+	options := struct {
+		ID     *int64   `json:"id"`
+		Depth  int      `json:"depth"`
+		Limit  int      `json:"limit"`
+		Fields []string `json:"fields"`
+	}{}
+	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
+		return
+	}
+	v := optionsValidator{}
+	v.requiredID("id", options.ID)
+	v.capped("depth", &options.Depth, h.conf.SubgraphMaxDepth)
+	v.capped("limit", &options.Limit, h.conf.SubgraphMaxLimit)
+	v.fields("fields", options.Fields)
+	if !h.tryValidate(w, &v) {
+		return
+	}
+	// # Try db search.
+	res, err := h.db.SearchSubgraphByID(r.Context(),
+		*options.ID, options.Depth, options.Limit)
+	// # The article itself is always included, if it exists.
+	if err == nil && len(res.Nodes) == 0 {
+		h.sendNotFound(w, fmt.Sprintf("no article with id %d", *options.ID))
+		return
+	}
+	if err == nil {
+		err = h.withFields(r.Context(), res.Nodes, options.Fields, nil)
+	}
 	// # Try response.
 	h.trySendWikiData(w, res, err)
 }
@@ -175,45 +568,136 @@ func (h *handler) searchHMLByID(w http.ResponseWriter, r *http.Request) {
 // a 'to' article id. In other words, if there are two articles in the database
 // where the former has id 8, the latter has id 9, and the former has a link to
 // the latter, then the query {rels:[[8,9]]} will return a list with a single true.
+// With the option {lookups:true}, each result is instead an object of form
+// {exists:bool, lookups:int}, see db.WikiRelCheck. Alternatively, all links
+// among a set of articles are returned with the option {ids:[int]} (instead of
+// rels), as a list of form [[from, to, lookups]], same as subgraph edges.
+// The amount of rels is only bound by the body size (the app checks all pairs
+// of the articles it shows), they're checked in chunks of at most RelsMax.
 // Curl example:
 // 	curl http://ip:port/data/check/relsexist -d "{\"rels\":[[4394, 4395]]}"
+// 	curl http://ip:port/data/check/relsexist -d "{\"ids\":[4394, 4395, 8]}"
 func (h *handler) checkRelsExist(w http.ResponseWriter, r *http.Request) {
 	// # Try get JSON option.
 	options := struct {
-		Rels [][2]int64 `json:"rels"`
+		Rels    [][2]int64 `json:"rels"`
+		Lookups bool       `json:"lookups"`
+		IDs     []int64    `json:"ids"`
 	}{}
 	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
 		return
 	}
-	// # Try db search.
-	res, err := h.db.CheckRelsExistByIDs(options.Rels)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	v := optionsValidator{}
+	for _, rel := range options.Rels {
+		if rel[0] < 0 || rel[1] < 0 {
+			v.check(false, "rels can't have negative ids")
+			break
+		}
 	}
-	// # Try response.
-	b, err := json.Marshal(res)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	v.check(options.IDs == nil || len(options.Rels) == 0,
+		"rels and ids can't both be set")
+	v.check(len(options.IDs) <= h.conf.LookupMax,
+		"ids can't have more than %d items", h.conf.LookupMax)
+	for _, id := range options.IDs {
+		if id < 0 {
+			v.check(false, "ids can't be negative")
+			break
+		}
+	}
+	if !h.tryValidate(w, &v) {
 		return
 	}
-	w.Write(b)
+	// # Try db search & response, depending on the mode.
+	switch {
+	case options.IDs != nil:
+		res, err := h.db.SearchRelsAmongIDs(r.Context(), options.IDs)
+		h.trySendWikiData(w, res, err)
+	case options.Lookups:
+		res := make([]db.WikiRelCheck, 0, len(options.Rels))
+		err := h.eachRelsChunk(options.Rels, func(rels [][2]int64) error {
+			chunk, err := h.db.CheckRelsByIDs(r.Context(), rels)
+			res = append(res, chunk...)
+			return err
+		})
+		h.trySendWikiData(w, res, err)
+	default:
+		res := make([]bool, 0, len(options.Rels))
+		err := h.eachRelsChunk(options.Rels, func(rels [][2]int64) error {
+			chunk, err := h.db.CheckRelsExistByIDs(r.Context(), rels)
+			res = append(res, chunk...)
+			return err
+		})
+		h.trySendWikiData(w, res, err)
+	}
+}
+
+// eachRelsChunk calls f with consecutive chunks of rels, each at most
+// RelsMax long, so that one db query never gets more than that
+// (all of them at once if RelsMax isn't set). Stops at the first error.
+func (h *handler) eachRelsChunk(rels [][2]int64, f func([][2]int64) error) error {
+	n := h.conf.RelsMax
+	if n <= 0 {
+		n = len(rels)
+	}
+	for i := 0; i < len(rels); i += n {
+		j := i + n
+		if j > len(rels) {
+			j = len(rels)
+		}
+		if err := f(rels[i:j]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // randomArticles endpoint accepts a JSON with form {limit:int}, where
-// the limit specifies how many random articles to return.
+// the limit specifies how many random articles to return. There are
+// no pages, so a cursor option is rejected.
+// The pick can be narrowed down with neighOf:int (only articles linked
+// from that article, a not_found error if it doesn't exist) and with
+// minInDegree:int (only articles linked from at least that many). The
+// same seed:int gives the same pick, as long as the graph is the same.
 // Curl example:
 // 	curl http://ip:port/data/random/articles -d "{\"limit\":1}"
+// 	curl http://ip:port/data/random/articles -d "{\"neighOf\":4394, \"seed\":7}"
 func (h *handler) randomArticles(w http.ResponseWriter, r *http.Request) {
 	// # Try get JSON option.
 	options := struct {
-		Limit int `json:"limit"`
+		Limit       int      `json:"limit"`
+		Cursor      *string  `json:"cursor"`
+		Fields      []string `json:"fields"`
+		NeighOf     *int64   `json:"neighOf"`
+		MinInDegree int      `json:"minInDegree"`
+		Seed        *int64   `json:"seed"`
 	}{}
 	if ok := h.tryUnpackRequestOptions(w, r, &options); !ok {
 		return
 	}
+	v := optionsValidator{}
+	v.limit("limit", &options.Limit, h.conf.PageLimitDefault, h.conf.PageLimitMax)
+	v.fields("fields", options.Fields)
+	v.noCursor("cursor", options.Cursor)
+	if options.NeighOf != nil {
+		v.id("neighOf", *options.NeighOf)
+	}
+	v.check(options.MinInDegree >= 0, "minInDegree can't be negative")
+	if !h.tryValidate(w, &v) {
+		return
+	}
 	// # Try db search.
-	res, err := h.db.RandomArticles(options.Limit)
+	res, err := h.db.SampleArticles(r.Context(), db.SampleOptions{
+		Amount:      options.Limit,
+		NeighOf:     options.NeighOf,
+		MinInDegree: options.MinInDegree,
+		Seed:        options.Seed,
+	})
+	err = h.withFields(r.Context(), res, options.Fields, err)
+	// # No neighbours might be a missing article.
+	if err == nil && len(res) == 0 && options.NeighOf != nil &&
+		!h.tryCheckArticlesExist(w, r, *options.NeighOf) {
+		return
+	}
 	// # Try response.
 	h.trySendWikiData(w, res, err)
 }
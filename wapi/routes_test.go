@@ -0,0 +1,155 @@
+package wapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+func TestLookupArticles(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "Lead of a.", "")
+	m.AddArticle("a", "", "")
+	b := m.AddArticle("b", "", "")
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	body := fmt.Sprintf(`{"ids":[%d, 12345, %d, 12345], "titles":["a", "nope"],
+		"fields":["summary"]}`, b, a)
+	rec := serveTest(h, "/api/v1/lookup/articles", body, nil)
+	res := db.WikiLookup{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+	if len(res.ByID) != 2 || res.ByID[b].Title != "b" || res.ByID[a].Summary != "Lead of a." {
+		t.Fatalf("unexpected byId: %s", rec.Body.String())
+	}
+	// # Lowest id of the ones with that title.
+	if res.ByTitle["a"] == nil || res.ByTitle["a"].ID != a ||
+		res.ByTitle["a"].Summary != "Lead of a." {
+		t.Fatalf("unexpected byTitle: %s", rec.Body.String())
+	}
+	if !reflect.DeepEqual(res.MissingIDs, []int64{12345}) ||
+		!reflect.DeepEqual(res.MissingTitles, []string{"nope"}) {
+		t.Fatalf("unexpected missing: %s", rec.Body.String())
+	}
+
+	// # Nothing to look up.
+	rec = serveTest(h, "/api/v1/lookup/articles", `{}`, nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK ||
+		body != `{"byId":{},"byTitle":{},"missingIds":[],"missingTitles":[]}` {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, body)
+	}
+}
+
+func TestCheckRelsExistModes(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "", "")
+	b := m.AddArticle("b", "", "")
+	m.AddRel(a, b)
+	m.IncrementRel(context.Background(), a, b)
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	cases := []struct{ body, want string }{
+		{fmt.Sprintf(`{"rels":[[%d,%d],[%d,%d]]}`, a, b, b, a), `[true,false]`},
+		{fmt.Sprintf(`{"rels":[[%d,%d],[%d,%d]], "lookups":true}`, a, b, b, a),
+			`[{"exists":true,"lookups":1},{"exists":false,"lookups":0}]`},
+		{fmt.Sprintf(`{"ids":[%d,%d]}`, a, b), fmt.Sprintf(`[[%d,%d,1]]`, a, b)},
+		{`{"ids":[]}`, `[]`},
+	}
+	for _, c := range cases {
+		rec := serveTest(h, "/api/v1/check/relsexist", c.body, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != c.want {
+			t.Fatalf("%s: wanted %s, got %d, %s", c.body, c.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestCheckRelsExistManyPairs(t *testing.T) {
+	m := memgraph.New()
+	ids := make([]int64, 11)
+	for i := range ids {
+		ids[i] = m.AddArticle(fmt.Sprint(i), "", "")
+	}
+	m.AddRel(ids[0], ids[1])
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	// # All pairs of 11 articles, as the app sends them.
+	rels := []string{}
+	for _, from := range ids {
+		for _, to := range ids {
+			if from != to {
+				rels = append(rels, fmt.Sprintf("[%d,%d]", from, to))
+			}
+		}
+	}
+	if len(rels) <= conf.WAPI.RelsMax {
+		t.Fatalf("wanted more than %d pairs, got %d", conf.WAPI.RelsMax, len(rels))
+	}
+	rec := serveTest(h, "/data/check/relsexist",
+		`{"rels":[`+strings.Join(rels, ",")+`]}`, nil)
+	res := []bool{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %d, %s", rec.Code, rec.Body.String())
+	}
+	if len(res) != len(rels) || !res[0] || res[1] || res[len(res)-1] {
+		t.Fatalf("unexpected result: %v", res)
+	}
+}
+
+func TestRandomArticlesSampling(t *testing.T) {
+	m := memgraph.New()
+	a := m.AddArticle("a", "", "")
+	b := m.AddArticle("b", "", "")
+	c := m.AddArticle("c", "", "")
+	lone := m.AddArticle("lone", "", "")
+	for i := 0; i < 10; i++ {
+		m.AddRel(m.AddArticle(fmt.Sprint(i), "", ""), c)
+	}
+	m.AddRel(a, b)
+	m.AddRel(a, c)
+	conf := config.Default()
+	h := &handler{db: m, cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	sample := func(body string) []db.WikiData {
+		rec := serveTest(h, "/api/v1/random/articles", body, nil)
+		res := []db.WikiData{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected response: %d, %s", body, rec.Code, rec.Body.String())
+		}
+		return res
+	}
+
+	// # Same seed, same pick.
+	first := sample(`{"limit":5, "seed":7}`)
+	if len(first) != 5 || !reflect.DeepEqual(first, sample(`{"limit":5, "seed":7}`)) {
+		t.Fatalf("unexpected seeded pick: %v", first)
+	}
+
+	for _, res := range [][]db.WikiData{
+		sample(fmt.Sprintf(`{"neighOf":%d}`, a)),
+		sample(fmt.Sprintf(`{"neighOf":%d, "seed":1}`, a)),
+	} {
+		if len(res) != 2 || res[0].ID != b && res[0].ID != c {
+			t.Fatalf("unexpected neighbours: %v", res)
+		}
+	}
+	if res := sample(`{"minInDegree":2, "fields":["inDegree"]}`); len(res) != 1 ||
+		res[0].ID != c || res[0].InDegree == nil || *res[0].InDegree != 11 {
+		t.Fatalf("unexpected well-linked: %v", res)
+	}
+	// # An existing article without neighbours isn't an error.
+	if res := sample(fmt.Sprintf(`{"neighOf":%d}`, lone)); len(res) != 0 {
+		t.Fatalf("unexpected neighbours: %v", res)
+	}
+}
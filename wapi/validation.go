@@ -0,0 +1,96 @@
+package wapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"wikinodes-server/db"
+)
+
+// Request options are validated before they reach the db, so that a
+// negative or huge limit (for instance) is answered with a bad_request
+// instead of being passed on to a query. Options that are left out
+// are given defaults instead. The bounds are set in config.WAPI.
+
+// optionsValidator collects problems with request options, so that
+// all of them can be reported in a single response.
+type optionsValidator struct {
+	problems []string
+}
+
+// check adds a problem (formatted like fmt.Sprintf) if not <ok>.
+func (v *optionsValidator) check(ok bool, format string, a ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Sprintf(format, a...))
+	}
+}
+
+// id checks that the id option <name> isn't negative.
+func (v *optionsValidator) id(name string, id int64) {
+	v.check(id >= 0, "%s can't be negative", name)
+}
+
+// requiredID is id for an option that can't be left out, i.e
+// <id> can't be nil.
+func (v *optionsValidator) requiredID(name string, id *int64) {
+	if id == nil {
+		v.check(false, "%s is required", name)
+		return
+	}
+	v.id(name, *id)
+}
+
+// limit checks the int option <name>, which is set to <def> if it's
+// left out (i.e zero). Negative values, or values above <max>, are
+// problems.
+func (v *optionsValidator) limit(name string, x *int, def, max int) {
+	v.check(*x >= 0, "%s can't be negative", name)
+	v.check(*x <= max, "%s can't exceed %d", name, max)
+	if *x == 0 {
+		*x = def
+	}
+}
+
+// capped is like limit, but values above <max> are lowered to <max>
+// rather than being a problem, and <max> is also the default.
+func (v *optionsValidator) capped(name string, x *int, max int) {
+	v.check(*x >= 0, "%s can't be negative", name)
+	if *x == 0 || *x > max {
+		*x = max
+	}
+}
+
+// str checks that the string option <name> isn't longer than <max>
+// bytes, nor empty if <required>.
+func (v *optionsValidator) str(name, s string, max int, required bool) {
+	v.check(s != "" || !required, "%s can't be empty", name)
+	v.check(len(s) <= max, "%s can't be longer than %d bytes", name, max)
+}
+
+// fields checks that all of the fields option <name> are optional
+// WikiData fields (see db.Fields).
+func (v *optionsValidator) fields(name string, fields []string) {
+	for _, f := range fields {
+		if !db.IsField(f) {
+			v.check(false, "%s has unknown field '%s', expected any of: %s",
+				name, f, strings.Join(db.Fields, ", "))
+			return
+		}
+	}
+}
+
+// noCursor checks that the cursor option <name> is left out, for
+// randomly ordered lists which can't be paged through.
+func (v *optionsValidator) noCursor(name string, cursor *string) {
+	v.check(cursor == nil, "%s isn't supported, results are randomly ordered", name)
+}
+
+// tryValidate sends a bad request response listing the problems
+// found by <v>, if any, in which case false is returned.
+func (h *handler) tryValidate(w http.ResponseWriter, v *optionsValidator) bool {
+	if len(v.problems) == 0 {
+		return true
+	}
+	h.sendBadRequest(w, "invalid options: "+strings.Join(v.problems, "; "))
+	return false
+}
@@ -0,0 +1,122 @@
+package wapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+// limitStore records the amount given to SampleArticles.
+type limitStore struct {
+	*memgraph.MemGraphManager
+	limit *int
+}
+
+func (s limitStore) SampleArticles(
+	ctx context.Context, opts db.SampleOptions) ([]*db.WikiData, error) {
+	*s.limit = opts.Amount
+	return s.MemGraphManager.SampleArticles(ctx, opts)
+}
+
+func TestValidationRejects(t *testing.T) {
+	conf := config.Default()
+	conf.WAPI.MaxBodyBytes = 1024
+	h := &handler{db: memgraph.New(), cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	cases := []struct {
+		path, body string
+		status     int
+		code       string
+	}{
+		// # Limits.
+		{"/data/random/articles", `{"limit":-1}`, 400, errBadRequest},
+		{"/data/random/articles", `{"limit":10000000}`, 400, errBadRequest},
+		{"/data/search/articles/bycontent", `{"str":"a", "limit":101}`, 400, errBadRequest},
+		{"/data/search/articles/byneigh", `{"id":1, "limit":-5}`, 400, errBadRequest},
+		{"/data/random/articles", `{"minInDegree":-1}`, 400, errBadRequest},
+		{"/data/search/subgraph", `{"id":1, "depth":-1}`, 400, errBadRequest},
+		// # Ids & strings.
+		{"/data/search/articles/byid", `{"id":-1}`, 400, errBadRequest},
+		{"/data/search/path", `{"from":1, "to":-1}`, 400, errBadRequest},
+		{"/data/random/articles", `{"neighOf":-1}`, 400, errBadRequest},
+		{"/data/search/articles/bycontent", `{"str":""}`, 400, errBadRequest},
+		{"/data/search/articles/bytitle",
+			`{"title":"` + strings.Repeat("a", conf.WAPI.StrMaxLen+1) + `"}`, 400, errBadRequest},
+		// # Rels.
+		{"/data/check/relsexist", `{"rels":[[1,-2]]}`, 400, errBadRequest},
+		{"/data/check/relsexist", `{"rels":[[1,2]], "ids":[1,2]}`, 400, errBadRequest},
+		{"/data/check/relsexist", `{"ids":[1,-2]}`, 400, errBadRequest},
+		// # Lookups.
+		{"/data/lookup/articles", `{"ids":[` + strings.Repeat("1,", conf.WAPI.LookupMax) + `1]}`, 400, errBadRequest},
+		{"/data/lookup/articles", `{"ids":[1], "titles":["` + strings.Repeat("a", conf.WAPI.StrMaxLen+1) + `"]}`, 400, errBadRequest},
+		{"/data/lookup/articles", `{"ids":[-1]}`, 400, errBadRequest},
+		// # Cursors.
+		{"/data/search/articles/byneigh", `{"id":1, "cursor":""}`, 400, errBadRequest},
+		{"/data/search/articles/bylinkedfrom", `{"id":1, "cursor":""}`, 400, errBadRequest},
+		{"/data/random/articles", `{"cursor":""}`, 400, errBadRequest},
+		{"/data/search/articles/bytitle",
+			`{"title":"a", "cursor":"` + encodeCursor(conf.WAPI.PageOffsetMax+1) + `"}`, 400, errBadRequest},
+		{"/data/search/articles/byid", `{"id":1, "cursor":"nope"}`, 400, errBadRequest},
+		// # Fields.
+		{"/data/search/articles/byid", `{"id":1, "fields":["html"]}`, 400, errBadRequest},
+		// # Body.
+		{"/data/random/articles", `{"limt":1}`, 400, errBadRequest},
+		{"/data/random/articles", `{"limit":1} {}`, 400, errBadRequest},
+		{"/data/random/articles", `{"limit":1` + strings.Repeat(" ", 1024) + `}`, 413, errTooLarge},
+	}
+	for _, c := range cases {
+		rec := serveTest(h, c.path, c.body, nil)
+		if rec.Code != c.status {
+			t.Fatalf("%s %.40s: wanted status %d, got %d", c.path, c.body, c.status, rec.Code)
+		}
+		if res := unpackAPIError(t, rec); res.Error.Code != c.code {
+			t.Fatalf("%s %.40s: wanted code %s, got %+v", c.path, c.body, c.code, res)
+		}
+	}
+}
+
+func TestValidationReportsAll(t *testing.T) {
+	conf := config.Default()
+	h := &handler{db: memgraph.New(), cache: memcache.New(conf.Cache), conf: conf.WAPI}
+
+	rec := serveTest(h, "/data/search/articles/byneigh", `{"id":-1, "limit":-1}`, nil)
+	res := unpackAPIError(t, rec)
+	if !strings.Contains(res.Error.Message, "id") ||
+		!strings.Contains(res.Error.Message, "limit") {
+		t.Fatalf("expected both problems in message: %+v", res)
+	}
+}
+
+func TestValidationDefaults(t *testing.T) {
+	conf := config.Default()
+	limit := 0
+	h := &handler{
+		db:    limitStore{memgraph.New(), &limit},
+		cache: memcache.New(conf.Cache),
+		conf:  conf.WAPI,
+	}
+
+	cases := []struct {
+		body  string
+		limit int
+	}{
+		{`{}`, conf.WAPI.PageLimitDefault},
+		{`{"limit":0}`, conf.WAPI.PageLimitDefault},
+		{fmt.Sprintf(`{"limit":%d}`, conf.WAPI.PageLimitMax), conf.WAPI.PageLimitMax},
+	}
+	for _, c := range cases {
+		rec := serveTest(h, "/data/random/articles", c.body, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d, %s", c.body, rec.Code, rec.Body.String())
+		}
+		if limit != c.limit {
+			t.Fatalf("%s: wanted limit %d, got %d", c.body, c.limit, limit)
+		}
+	}
+}
@@ -1,42 +1,71 @@
 package wapi
 
 import (
+	"context"
 	"net/http"
 	"strings"
 	"wikinodes-server/config"
 	"wikinodes-server/db"
 )
 
-var (
-	ip   = config.WAPIIP
-	port = config.WAPIPort
-	// # Server IO time limitation.
-	readTimeout  = config.ReadTimeout
-	writeTimeout = config.WriteTimeout
-
-	pathToReactApp = config.PathToReactApp
-)
-
 // handler serves as a bridge between the app and
 // other packages, mainly db.
 type handler struct {
 	db    db.StoredWikiManager
 	cache db.CacheManager
+	conf  config.WAPI
+	// # Serves the React app.
+	static http.Handler
 }
 
-// Start starts the app.
-func Start(db db.StoredWikiManager, cache db.CacheManager) error {
+// Server is the app, wrapping an http.Server so it can be
+// shut down gracefully.
+type Server struct {
+	srv *http.Server
+}
+
+// New sets up the app, configured by <conf>. It's started
+// with ListenAndServe.
+func New(conf config.WAPI, db db.StoredWikiManager, cache db.CacheManager) *Server {
 	// # Enable interface to other ports of this api.
-	handler := handler{db: db, cache: cache}
-	handler.setRoutes()
+	handler := handler{
+		db:     db,
+		cache:  cache,
+		conf:   conf,
+		static: http.FileServer(http.Dir(conf.PathToReactApp)),
+	}
 
 	// # Server configs.
-	server := http.Server{
-		Addr:         ip + ":" + port,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
+	return &Server{srv: &http.Server{
+		Addr:         conf.IP + ":" + conf.Port,
+		Handler:      handler.routes(),
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
+	}}
+}
+
+// Handler returns the handler of the app, e.g for serving it
+// with httptest.
+func (s *Server) Handler() http.Handler {
+	return s.srv.Handler
+}
+
+// ListenAndServe starts the app and blocks until it fails or
+// is shut down. A nil error is returned in the latter case.
+func (s *Server) ListenAndServe() error {
+	err := s.srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
 	}
-	return server.ListenAndServe()
+	return err
+}
+
+// Shutdown stops the app from accepting new connections, then
+// waits for in-flight requests to finish, or for <ctx> to be
+// done, whichever comes first. ListenAndServe returns right away,
+// so the caller should wait for Shutdown before cleaning up.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
 }
 
 func extractIP(r *http.Request) (string, bool) {
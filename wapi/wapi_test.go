@@ -0,0 +1,94 @@
+package wapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"wikinodes-server/config"
+	"wikinodes-server/db"
+	"wikinodes-server/db/memcache"
+	"wikinodes-server/db/memgraph"
+)
+
+// slowStore delays SearchArticlesByID, for having requests
+// in flight during shutdown.
+type slowStore struct {
+	*memgraph.MemGraphManager
+	delay time.Duration
+}
+
+func (s slowStore) SearchArticlesByID(
+	ctx context.Context, id int64) ([]*db.WikiData, error) {
+	time.Sleep(s.delay)
+	return s.MemGraphManager.SearchArticlesByID(ctx, id)
+}
+
+// freePort returns a port that was free a moment ago.
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestShutdownDrains(t *testing.T) {
+	m := memgraph.New()
+	id := m.AddArticle("a", "", "")
+	conf := config.Default()
+	conf.WAPI.IP = "127.0.0.1"
+	conf.WAPI.Port = freePort(t)
+	s := New(conf.WAPI, slowStore{m, time.Millisecond * 200}, memcache.New(conf.Cache))
+
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+	url := "http://127.0.0.1:" + conf.WAPI.Port + "/data/search/articles/byid"
+	body := `{"id":` + strconv.FormatInt(id, 10) + `}`
+
+	// # Wait until up.
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+conf.WAPI.Port)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("server didn't start: %v", err)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// # Request in flight while shutting down.
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Post(url, "application/json", strings.NewReader(body))
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown err: %v", err)
+	}
+	if code := <-status; code != http.StatusOK {
+		t.Fatalf("in-flight request wasn't drained, status: %v", code)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("unexpected serve err: %v", err)
+	}
+	// # No new connections.
+	if _, err := http.Post(url, "application/json", strings.NewReader(body)); err == nil {
+		t.Fatal("expected err after shutdown")
+	}
+}